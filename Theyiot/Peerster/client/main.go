@@ -3,12 +3,14 @@ package main
 import (
 	"errors"
 	"flag"
+	"fmt"
 	"github.com/Theyiot/Peerster/constants"
 	"github.com/Theyiot/Peerster/gossiper"
 	"github.com/Theyiot/Peerster/util"
 	"github.com/dedis/protobuf"
 	"net"
 	"strings"
+	"time"
 )
 
 func main() {
@@ -19,6 +21,8 @@ func main() {
 	msg := flag.String("msg", constants.DEFAULT_MESSAGE, "message to be sent")
 	keywords := flag.String("keywords", "", "keywords to search")
 	budget := flag.Int("budget", constants.DEFAULT_BUDGET, "budget of search request")
+	name := flag.String("name", "", "The name, bound on the blockchain, of the file to download")
+	routes := flag.Bool("routes", false, "Display the routing table of the gossiper, or only the route to dest")
 
 	flag.Parse()
 
@@ -26,9 +30,15 @@ func main() {
 	util.FailOnError(err)
 
 	conn, err := net.DialUDP(constants.UDP_VERSION, nil, serverAddr)
+	util.FailOnError(err)
 	defer conn.Close()
 
-	clientGossipPacket, err := createClientPacket(*destination, *file, *request, *keywords, *msg, *budget)
+	if *routes {
+		requestRoutes(conn, *destination, *file, *request, *keywords, *name)
+		return
+	}
+
+	clientGossipPacket, err := createClientPacket(*destination, *file, *request, *keywords, *name, *msg, *budget)
 
 	if util.CheckAndPrintError(err) {
 		return
@@ -46,8 +56,13 @@ func main() {
 	return an error if the provided parameters are inconsistent (if the type can not be inferred
 	from the provided inputs of the user)
  */
-func createClientPacket(destination, fileName, request, keywords, msg string, budget int) (gossiper.ClientPacket, error) {
-	if isSimpleMessage(destination, fileName, request, keywords, msg) {
+func createClientPacket(destination, fileName, request, keywords, name, msg string, budget int) (gossiper.ClientPacket, error) {
+	if !isNull(name) {
+		if !isFileNameRequest(destination, fileName, request, keywords) {
+			return gossiper.ClientPacket{}, errors.New("a file requested by name can not be combined with other options")
+		}
+		return gossiper.ClientPacket{FileNameRequest: &gossiper.FileNameRequestMessage{FileName: name}}, nil
+	} else if isSimpleMessage(destination, fileName, request, keywords, msg) {
 		return gossiper.ClientPacket{Simple: &gossiper.SimpleMessage{Contents: msg}}, nil
 	} else if isPrivateMessage(destination, fileName, request, keywords, msg) {
 		return gossiper.ClientPacket{Private: &gossiper.PrivateMessage{Text: msg, Destination: destination}}, nil
@@ -66,6 +81,41 @@ func createClientPacket(destination, fileName, request, keywords, msg string, bu
 	}
 }
 
+/*
+	requestRoutes asks the gossiper for its route towards the destination, or for its whole routing table if no
+	destination is provided, and displays the answer
+ */
+func requestRoutes(conn *net.UDPConn, destination, fileName, request, keywords, name string) {
+	if !isFileNameRequest("", fileName, request, keywords) || !isNull(name) {
+		util.CheckAndPrintError(errors.New("the routing table can only be requested for a destination"))
+		return
+	}
+	bytesToSend, err := protobuf.Encode(&gossiper.ClientPacket{
+		RoutesRequest: &gossiper.RoutesRequestMessage{Destination: destination}})
+	util.FailOnError(err)
+	_, err = conn.Write(bytesToSend)
+	util.FailOnError(err)
+
+	buf := make([]byte, 65535)
+	util.FailOnError(conn.SetReadDeadline(time.Now().Add(constants.ROUTES_REPLY_TIMEOUT * time.Second)))
+	n, err := conn.Read(buf)
+	if util.CheckAndPrintError(err) {
+		return
+	}
+	reply := gossiper.RoutesReply{}
+	if util.CheckAndPrintError(protobuf.Decode(buf[:n], &reply)) {
+		return
+	}
+
+	if len(reply.Routes) == 0 {
+		fmt.Println("NO ROUTE KNOWN")
+	}
+	for _, route := range reply.Routes {
+		fmt.Printf("DESTINATION %s NEXT-HOP %s SEQ %d HOPS %d UPDATED %s (%ds ago) LEARNED-FROM %s\n",
+			route.Destination, route.NextHop, route.Seq, route.Hops, route.Updated, route.Age, route.LearnedFrom)
+	}
+}
+
 /*
 	isSimpleMessage determines and return a boolean value that tells whether the provided parameters
 	correspond to a simple message or not
@@ -107,6 +157,14 @@ func isSearchRequest(destination, fileName, request, keywords string) bool {
 	return isNull(destination) && isNull(fileName) && isNull(request) && !isNull(keywords)
 }
 
+/*
+	isFileNameRequest determines and return a boolean value that tells whether the provided parameters, besides
+	the name of the file, are compatible with a request for a file by its name or not
+ */
+func isFileNameRequest(destination, fileName, request, keywords string) bool {
+	return isNull(destination) && isNull(fileName) && isNull(request) && isNull(keywords)
+}
+
 /*
 	isNull checks whether the provided string is empty or not
  */
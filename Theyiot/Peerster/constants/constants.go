@@ -6,8 +6,65 @@ const HOP_LIMIT_BIG = 20
 const DEFAULT_BUDGET = 2
 const MAX_BUDGET = 32
 const NOUNCE_SIZE = 32
+const MAX_ORPHAN_BLOCKS = 1024
+const BLOCK_REQUEST_TIMEOUT = 5
+const ORPHAN_BLOCK_EXPIRY = 600
+const GENESIS_DIFFICULTY = 16
+const RETARGET_INTERVAL = 10
+const TARGET_BLOCK_TIME = 10
+const MIN_DIFFICULTY = 1
+const MAX_DIFFICULTY = 240
+const MAX_FUTURE_BLOCK_TIME = 120
+const MAX_TRANSACTIONS_PER_BLOCK = 64
 const DEFAULT_FULL_MATCHES = 2
+const ROUTE_EXPIRY = 300
+const ROUTE_EXPIRY_RTIMERS = 3
+const PEER_SUSPECT_AFTER = 3
+const PEER_DEAD_AFTER = 6
+const PEER_ALIVE = "alive"
+const PEER_SUSPECT = "suspect"
+const PEER_DEAD = "dead"
+const PEER_REMOVED = "removed"
+const DEAD_PEER_PROBE_TIMER = 10
+const DEAD_PEER_EXPIRY = 600
+const PEER_EXCHANGE_TIMER = 10
+const PEER_EXCHANGE_SAMPLE_SIZE = 8
+const PEER_RECENTLY_ALIVE = 60
+const MAX_PEERS = 64
+const SEND_QUEUE_SIZE = 64
+const SEND_QUEUE_IDLE_TIMEOUT = 30
+const MAX_SEND_QUEUES = 256
+const MAX_DATAGRAM_SIZE = CHUNK_SIZE + 1184
+const FRAGMENT_SIZE = MAX_DATAGRAM_SIZE - 64
+const MAX_REASSEMBLED_SIZE = 4 << 20
+const MAX_PENDING_REASSEMBLIES = 128
+const MAX_PENDING_REASSEMBLIES_PER_SENDER = 8
+const MAX_REASSEMBLY_BUFFER = 16 << 20
+const REASSEMBLY_TIMEOUT = 5
+const MAX_CLIENT_PACKET_SIZE = 65535
+const MEMORY_TRANSPORT_INBOX_SIZE = 1024
+const SEND_PRIORITIES = 3
+const SEND_PRIORITY_CONTROL = 0
+const SEND_PRIORITY_NORMAL = 1
+const SEND_PRIORITY_BEST_EFFORT = 2
+const ROUTE_FROM_RUMOR = "Rumor"
+const ROUTE_FROM_DIRECT_RUMOR = "DirectRumor"
+const DIRECT_PROBE_TIMEOUT = 5
+const ROUTE_FROM_SEARCH_REQUEST = "SearchRequest"
+const ROUTE_FROM_SEARCH_REPLY = "SearchReply"
+const ROUTE_FROM_DATA_REQUEST = "DataRequest"
+const ROUTES_REPLY_TIMEOUT = 2
+const PRIVATE_ACK_TIMEOUT = 2
+const MAX_PRIVATE_ATTEMPTS = 5
+const MAX_MAILBOX_SIZE = 64
+const PRIVATE_STATUS_QUEUED = "queued"
+const PRIVATE_STATUS_PENDING = "pending"
+const PRIVATE_STATUS_DELIVERED = "delivered"
+const PRIVATE_STATUS_FAILED = "failed"
 const CHUNK_SIZE = 8192
+const DEFAULT_DOWNLOAD_WINDOW = 8
+const MAX_CHUNK_ATTEMPTS = 10
+const DATA_REQUEST_TIMEOUT = 5
 const DEFAULT_PORT = "8080"
 const DEFAULT_GOSSIP_ADDR = "127.0.0.1:5000"
 const DEFAULT_BLOCK_HASH = "0000000000000000000000000000000000000000000000000000000000000000"
@@ -18,3 +75,21 @@ const LOCALHOST = "127.0.0.1"
 const PATH_DOWNOADS = "_Downloads/"
 const PATH_SHARED_FILES = "_SharedFiles/"
 const PATH_FILE_CHUNKS = "._FileChunks/"
+const METAFILE_MAGIC = "PMTF"
+const METAFILE_HEADER_SIZE = 8
+const PATH_DOWNLOAD_JOURNALS = "._DownloadJournals/"
+const PATH_STATE = "._State/"
+const STATE_FILE = "state.log"
+const IDENTITY_FILE = "identity.key"
+const ENCRYPTION_KEY_DOMAIN = "Peerster X25519 key"
+const BUCKET_RUMORS = "rumors"
+const BUCKET_VECTOR_CLOCK = "vectorClock"
+const BUCKET_PRIVATES = "privates"
+const BUCKET_PRIVATE_STATUSES = "privateStatuses"
+const BUCKET_MAILBOX = "mailbox"
+const BUCKET_DSDV = "dsdv"
+const BUCKET_INDEXED_FILES = "indexedFiles"
+const BUCKET_BLOCKCHAIN = "blockchain"
+const BUCKET_CURRENT_BLOCK = "currentBlock"
+const BUCKET_PUBLIC_KEYS = "publicKeys"
+const BUCKET_ENCRYPTION_KEYS = "encryptionKeys"
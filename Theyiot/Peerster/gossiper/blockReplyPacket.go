@@ -0,0 +1,31 @@
+package gossiper
+
+import (
+	"encoding/hex"
+	"net"
+)
+
+/*
+	receiveBlockReply handles the packets of BlockReply type. The received block is added to the blockchain if we
+	know its parent, and is otherwise buffered while we ask for the parent
+ */
+func (gossiper *Gossiper) receiveBlockReply(gossipPacket GossipPacket, addr *net.UDPAddr) {
+	block := gossipPacket.BlockReply.Block
+	hash := block.Hash()
+	hashHex := hex.EncodeToString(hash[:])
+	gossiper.BlockRequests.Delete(hashHex)
+	if gossiper.isKnownBlock(hashHex) {
+		return
+	}
+
+	if !gossiper.isKnownBlock(hex.EncodeToString(block.PrevHash[:])) {
+		gossiper.bufferOrphanBlock(block, addr)
+		return
+	}
+
+	if err := gossiper.validateBlock(block); err != nil {
+		println("ERROR : rejecting block " + hashHex + " from " + addr.String() + " : " + err.Error())
+		return
+	}
+	gossiper.submitBlock(block)
+}
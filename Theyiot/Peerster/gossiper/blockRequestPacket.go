@@ -0,0 +1,111 @@
+package gossiper
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/Theyiot/Peerster/constants"
+	"net"
+	"time"
+)
+
+/*
+	receiveBlockRequest handles the packets of BlockRequest type, by sending back the requested block if we have it
+ */
+func (gossiper *Gossiper) receiveBlockRequest(gossipPacket GossipPacket, addr *net.UDPAddr) {
+	hashHex := hex.EncodeToString(gossipPacket.BlockRequest.HashValue)
+	block, exist := gossiper.Blockchain.Load(hashHex)
+	if !exist {
+		return
+	}
+	blockReply := BlockReply{Block: block.(Block)}
+	gossiper.send(PacketToSend{GossipPacket: &GossipPacket{BlockReply: &blockReply}, Address: addr})
+}
+
+/*
+	sendBlockRequest asks the given peer for the block with the given hash. A block that was requested recently is
+	not requested again until the request times out, so that a chain of orphans only triggers one request per
+	missing block
+ */
+func (gossiper *Gossiper) sendBlockRequest(hashHex string, addr *net.UDPAddr) {
+	now := gossiper.Clock.Now()
+	lastRequest, exist := gossiper.BlockRequests.Load(hashHex)
+	if exist && now.Sub(lastRequest.(time.Time)) < constants.BLOCK_REQUEST_TIMEOUT * time.Second {
+		return
+	}
+	gossiper.BlockRequests.Store(hashHex, now)
+
+	blockRequest := BlockRequest{HashValue: stringToHash(hashHex)}
+	gossiper.send(PacketToSend{GossipPacket: &GossipPacket{BlockRequest: &blockRequest}, Address: addr})
+}
+
+/*
+	bufferOrphanBlock keeps a block whose parent we don't know, and asks the peer that sent it for the first
+	ancestor of the block that we have neither in the blockchain nor in the orphan blocks
+ */
+func (gossiper *Gossiper) bufferOrphanBlock(block Block, addr *net.UDPAddr) {
+	hash := block.Hash()
+	if minDifficulty := gossiper.minOrphanDifficulty(); block.Difficulty < minDifficulty {
+		println("ERROR : rejecting orphan block " + hex.EncodeToString(hash[:]) + " : the difficulty is " +
+			fmt.Sprint(block.Difficulty) + " instead of at least " + fmt.Sprint(minDifficulty))
+		return
+	}
+	if !hasValidProofOfWork(hash, block.Difficulty) {
+		println("ERROR : rejecting orphan block " + hex.EncodeToString(hash[:]) + " : the proof of work is not valid")
+		return
+	}
+	gossiper.OrphanBlocks.Add(block, addr, gossiper.Clock.Now())
+	gossiper.sendBlockRequest(gossiper.OrphanBlocks.MissingAncestor(hex.EncodeToString(block.PrevHash[:])), addr)
+}
+
+/*
+	minOrphanDifficulty returns the smallest difficulty we accept for an orphan block, namely the smallest of the
+	genesis difficulty and of the difficulty of the head of our main chain. An orphan can not be validated before
+	its ancestors are known, so this keeps cheap blocks from filling the orphan blocks
+ */
+func (gossiper *Gossiper) minOrphanDifficulty() uint32 {
+	difficulty := gossiper.Consensus.GenesisDifficulty
+	if head, exist := gossiper.Blockchain.Load(gossiper.CurrentBlock.GetCurrentHash()); exist &&
+		head.(Block).Difficulty < difficulty {
+		difficulty = head.(Block).Difficulty
+	}
+	if difficulty < constants.MIN_DIFFICULTY {
+		difficulty = constants.MIN_DIFFICULTY
+	}
+	return difficulty
+}
+
+/*
+	requestMissingAncestors periodically drops the orphan blocks that waited too long for their ancestors, and asks
+	again for the missing ancestors of the other ones, whose requests may have been lost
+ */
+func (gossiper *Gossiper) requestMissingAncestors() {
+	ticker := gossiper.Clock.NewTicker(constants.BLOCK_REQUEST_TIMEOUT * time.Second)
+	defer ticker.Stop()
+	for gossiper.wait(ticker.C) {
+		now := gossiper.Clock.Now()
+		gossiper.OrphanBlocks.Expire(constants.ORPHAN_BLOCK_EXPIRY * time.Second, now)
+		gossiper.BlockRequests.Range(func(hashHex, lastRequest interface{}) bool {
+			if now.Sub(lastRequest.(time.Time)) >= constants.BLOCK_REQUEST_TIMEOUT * time.Second {
+				gossiper.BlockRequests.Delete(hashHex)
+			}
+			return true
+		})
+		for hashHex, addr := range gossiper.OrphanBlocks.MissingAncestors() {
+			if !gossiper.isKnownBlock(hashHex) {
+				gossiper.sendBlockRequest(hashHex, addr)
+			}
+		}
+	}
+}
+
+/*
+	isKnownBlock returns whether the given hash is the one of a block of our blockchain or the one that precedes
+	the first block
+ */
+func (gossiper *Gossiper) isKnownBlock(hashHex string) bool {
+	if hashHex == constants.DEFAULT_BLOCK_HASH {
+		return true
+	}
+	_, exist := gossiper.Blockchain.Load(hashHex)
+	return exist
+}
@@ -0,0 +1,107 @@
+package gossiper
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/Theyiot/Peerster/constants"
+)
+
+/*
+	validateBlock checks that a block, either mined by us or received from another peer, can be added to the
+	blockchain. It returns an error describing the reason why the block is invalid, if it is the case
+ */
+func (gossiper *Gossiper) validateBlock(block Block) error {
+	prevHashHex := hex.EncodeToString(block.PrevHash[:])
+	parent, exist := gossiper.Blockchain.Load(prevHashHex)
+	if prevHashHex != constants.DEFAULT_BLOCK_HASH && !exist {
+		return errors.New("the parent block " + prevHashHex + " is unknown")
+	}
+
+	expectedDifficulty := gossiper.expectedDifficulty(prevHashHex)
+	if block.Difficulty != expectedDifficulty {
+		return errors.New("the difficulty is " + fmt.Sprint(block.Difficulty) + " instead of " +
+			fmt.Sprint(expectedDifficulty))
+	}
+	if !hasValidProofOfWork(block.Hash(), block.Difficulty) {
+		return errors.New("the proof of work is not valid")
+	}
+
+	if exist && block.Timestamp < parent.(Block).Timestamp {
+		return errors.New("the block is older than its parent")
+	}
+	if block.Timestamp > gossiper.Clock.Now().Unix() + constants.MAX_FUTURE_BLOCK_TIME {
+		return errors.New("the block is too far in the future")
+	}
+
+	names := make(map[string]bool)
+	for _, transaction := range block.Transactions {
+		if err := validateTransactionFormat(transaction); err != nil {
+			return err
+		}
+		if names[transaction.File.Name] {
+			return errors.New("the name " + transaction.File.Name + " is claimed twice in the block")
+		}
+		names[transaction.File.Name] = true
+	}
+
+	boundNames := gossiper.getNamesBoundOnBranch(prevHashHex)
+	for name := range names {
+		if boundNames[name] {
+			return errors.New("the name " + name + " is already bound on the chain of the block")
+		}
+	}
+	return nil
+}
+
+/*
+	validateTransaction checks that a transaction can be added to the pending transactions, namely that it is well
+	formed and that its name is not already bound on the main chain
+ */
+func (gossiper *Gossiper) validateTransaction(transaction TxPublish) error {
+	if err := validateTransactionFormat(transaction); err != nil {
+		return err
+	}
+	if _, exist := gossiper.NameToMetaHash.Load(transaction.File.Name); exist {
+		return errors.New("the name " + transaction.File.Name + " is already bound on the main chain")
+	}
+	return nil
+}
+
+/*
+	validateTransactionFormat checks that a transaction claims a non-empty name for a well-formed metafile hash
+ */
+func validateTransactionFormat(transaction TxPublish) error {
+	if transaction.File.Name == "" {
+		return errors.New("a transaction claims an empty name")
+	}
+	if len(transaction.File.MetafileHash) != sha256.Size {
+		return errors.New("the metafile hash of " + transaction.File.Name + " has " +
+			fmt.Sprint(len(transaction.File.MetafileHash)) + " bytes instead of " + fmt.Sprint(sha256.Size))
+	}
+	if transaction.File.Size < 0 {
+		return errors.New("the file " + transaction.File.Name + " has a negative size")
+	}
+	return nil
+}
+
+/*
+	getNamesBoundOnBranch returns the set of names claimed by the transactions of the given block and of all its
+	ancestors
+ */
+func (gossiper *Gossiper) getNamesBoundOnBranch(hashHex string) map[string]bool {
+	names := make(map[string]bool)
+	for hashHex != constants.DEFAULT_BLOCK_HASH {
+		block, exist := gossiper.Blockchain.Load(hashHex)
+		if !exist {
+			break
+		}
+		for _, transaction := range block.(Block).Transactions {
+			names[transaction.File.Name] = true
+		}
+		prevHash := block.(Block).PrevHash
+		hashHex = hex.EncodeToString(prevHash[:])
+	}
+	return names
+}
@@ -2,16 +2,18 @@ package gossiper
 
 import (
 	"encoding/hex"
-	"github.com/Theyiot/Peerster/constants"
 	"net"
 )
 
 func (gossiper *Gossiper) receiveTxPublish(gossipPacket GossipPacket, addr *net.UDPAddr) {
-	_, exist := gossiper.NameToMetaHash.Load(gossipPacket.TxPublish.File.Name)
-	if exist {
+	if err := gossiper.validateTransaction(*gossipPacket.TxPublish); err != nil {
+		println("ERROR : rejecting transaction from " + addr.String() + " : " + err.Error())
 		return
 	}
-	gossiper.Transactions.Add(gossipPacket.TxPublish)
+	if gossiper.Transactions.Add(gossipPacket.TxPublish) {
+		gossiper.refreshMining()
+		gossiper.forwardTxPublish(gossipPacket, addr.String())
+	}
 }
 
 func (gossiper *Gossiper) forwardTxPublish(gossipPacket GossipPacket, peerAddr string) {
@@ -26,15 +28,24 @@ func (gossiper *Gossiper) forwardTxPublish(gossipPacket GossipPacket, peerAddr s
 
 func (gossiper *Gossiper) receiveBlockPublish(gossipPacket GossipPacket, addr *net.UDPAddr) {
 	block := gossipPacket.BlockPublish.Block
-	newHash, prevHashHex := block.Hash(), hex.EncodeToString(block.PrevHash[:])
-	_, exist := gossiper.Blockchain.Load(prevHashHex)
+	newHash := block.Hash()
+	newHashHex := hex.EncodeToString(newHash[:])
+	if _, exist := gossiper.Blockchain.Load(newHashHex); exist {
+		return
+	}
 
-	// CHECK IF THE INITIAL ARRAY IS STILL MINED
-	if !exist || newHash[0] != 0 || newHash[1] != 0 {
+	// WE ASK FOR THE MISSING ANCESTORS OF AN ORPHAN BLOCK
+	if !gossiper.isKnownBlock(hex.EncodeToString(block.PrevHash[:])) {
+		gossiper.bufferOrphanBlock(block, addr)
 		return
 	}
 
-	gossiper.ToAddToBlockchain <- block
+	if err := gossiper.validateBlock(block); err != nil {
+		println("ERROR : rejecting block " + newHashHex + " from " + addr.String() + " : " + err.Error())
+		return
+	}
+
+	gossiper.submitBlock(block)
 	gossiper.forwardBlockPublish(gossipPacket, addr.String())
 }
 
@@ -47,35 +58,3 @@ func (gossiper *Gossiper) forwardBlockPublish(gossipPacket GossipPacket, peerAdd
 
 	gossiper.broadcastGossipPacket(gossipPacket, gossiper.Peers.GetAddressesExcept(peerAddr))
 }
-
-func (gossiper *Gossiper) checkNameInLongestChain(newTransaction TxPublish) bool {
-	lastBlock := false
-	blockHashHex := gossiper.CurrentBlock.GetCurrentHash()
-
-	for {
-		block, _ := gossiper.Blockchain.Load(blockHashHex)
-		blockHashHex = hex.EncodeToString(block.(Block).PrevHash[:])
-		for _, transaction := range block.(Block).Transactions {
-			if transaction.File.Name == newTransaction.File.Name {
-				return true
-			}
-		}
-		if blockHashHex == constants.DEFAULT_BLOCK_HASH {
-			if lastBlock {
-				return false
-			}
-			lastBlock = true
-		}
-	}
-}
-
-func (gossiper *Gossiper) computeDepth(prevHashHex string) uint64 {
-	counter := uint64(1)
-	for {
-		block, _ := gossiper.Blockchain.Load(prevHashHex)
-		if hex.EncodeToString(block.(Block).PrevHash[:]) == constants.DEFAULT_BLOCK_HASH {
-			return counter
-		}
-		prevHashHex = hex.EncodeToString(block.(Block).PrevHash[:])
-	}
-}
@@ -1,8 +1,11 @@
 package gossiper
 
 import (
+	"errors"
+	"github.com/Theyiot/Peerster/constants"
 	"github.com/Theyiot/Peerster/util"
 	"github.com/dedis/protobuf"
+	"net"
 )
 
 /*
@@ -11,9 +14,11 @@ import (
  */
 func (gossiper *Gossiper) handleClient() {
 	for {
-		buf := make([]byte, 4096)
-		n, _, err := gossiper.UIServer.ReadFromUDP(buf)
-		if util.CheckAndPrintError(err) {
+		buf := make([]byte, constants.MAX_CLIENT_PACKET_SIZE)
+		n, clientAddr, err := gossiper.UIServer.Receive(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		} else if util.CheckAndPrintError(err) {
 			continue
 		}
 
@@ -23,15 +28,16 @@ func (gossiper *Gossiper) handleClient() {
 			continue
 		}
 
-		go gossiper.sendClientMessage(packet)
+		gossiper.spawn(func() { gossiper.sendClientMessage(packet, clientAddr) })
 	}
 }
 
 /*
 	sendClientMessage takes care of processing the packets received from the client. It makes sure the packets
-	are valid and forwards the request to the right function
+	are valid and forwards the request to the right function. Requests expecting an answer are answered to the
+	address of the client
  */
-func (gossiper *Gossiper) sendClientMessage(packet ClientPacket) {
+func (gossiper *Gossiper) sendClientMessage(packet ClientPacket, clientAddr *net.UDPAddr) {
 	if !checkExactlyOnePacketTypeClient(packet) {
 		println("CLIENT SIDE : More than one field of the packet was not <nil>, dropping this packet")
 		return
@@ -56,11 +62,33 @@ func (gossiper *Gossiper) sendClientMessage(packet ClientPacket) {
 		}
 	} else if packet.FileSearchRequest != nil {
 		gossiper.sendSearchRequest(packet.FileSearchRequest.Keywords, packet.FileSearchRequest.Budget)
+	} else if packet.FileNameRequest != nil {
+		gossiper.requestFileByName(packet.FileNameRequest.FileName)
+	} else if packet.RoutesRequest != nil {
+		gossiper.sendRoutesToClient(packet.RoutesRequest.Destination, clientAddr)
 	} else {
 		println("ERROR : client did not send any know kind of packets.")
 	}
 }
 
+/*
+	sendRoutesToClient answers to a client that asked for the route towards the given destination, or for the whole
+	routing table if no destination was given
+ */
+func (gossiper *Gossiper) sendRoutesToClient(destination string, clientAddr *net.UDPAddr) {
+	routes := make([]RouteJSON, 0)
+	for _, route := range gossiper.getRoutesAsList() {
+		if destination == "" || route.Destination == destination {
+			routes = append(routes, route)
+		}
+	}
+	bytesToSend, err := protobuf.Encode(&RoutesReply{Routes: routes})
+	if util.CheckAndPrintError(err) {
+		return
+	}
+	util.CheckAndPrintError(gossiper.UIServer.Send(bytesToSend, clientAddr))
+}
+
 /*
 	checkExactlyOnePacketTypeClient checks that there is one and only one type of packet that is not nil
  */
@@ -71,6 +99,8 @@ func checkExactlyOnePacketTypeClient(gossipPacket ClientPacket) bool {
 	if gossipPacket.FileIndex != nil { count++ }
 	if gossipPacket.FileRequest != nil { count++ }
 	if gossipPacket.FileSearchRequest != nil { count++ }
+	if gossipPacket.FileNameRequest != nil { count++ }
+	if gossipPacket.RoutesRequest != nil { count++ }
 	if count == 0 {
 		println("Found 0 matching type of packet")
 	}
@@ -0,0 +1,76 @@
+package gossiper
+
+import (
+	"github.com/Theyiot/Peerster/constants"
+	"github.com/Theyiot/Peerster/util"
+	"io"
+	"os"
+)
+
+/*
+	Config holds everything needed to create a gossiper. The timers are in seconds, and a value of 0 disables the
+	corresponding routine. If the transports are nil, UDP sockets are opened on GossipAddr and on UIPort of the
+	localhost. The text of the events of the gossiper is written to Output, one per line, unless Output is nil. The
+	events can also be received by subscribing to gossiper.Events
+ */
+type Config struct {
+	Name				string
+	GossipAddr			string
+	UIPort				string
+	Peers				string
+	DataDir				string
+	Simple				bool
+	Rtimer				uint
+	Difficulty			uint
+	Window				uint
+	RouteExpiry			uint
+	DirectRoutes		bool
+	SuspectAfter		uint
+	DeadAfter			uint
+	PeerExchangeTimer	uint
+	SendQueueSize		uint
+	PeerRate			uint
+	GlobalRate			uint
+	MailboxReplicas		uint
+	Mining				bool
+	WebServer			bool
+	GossipServer		util.Transport
+	UIServer			util.Transport
+	Clock				util.Clock
+	Output				io.Writer
+}
+
+/*
+	DefaultConfig returns the configuration used by the command line when no flag is given
+ */
+func DefaultConfig() Config {
+	return Config{
+		Name:				constants.DEFAULT_NAME,
+		GossipAddr:			constants.DEFAULT_GOSSIP_ADDR,
+		UIPort:				constants.DEFAULT_PORT,
+		Difficulty:			constants.GENESIS_DIFFICULTY,
+		Window:				constants.DEFAULT_DOWNLOAD_WINDOW,
+		SuspectAfter:		constants.PEER_SUSPECT_AFTER,
+		DeadAfter:			constants.PEER_DEAD_AFTER,
+		PeerExchangeTimer:	constants.PEER_EXCHANGE_TIMER,
+		SendQueueSize:		constants.SEND_QUEUE_SIZE,
+		Mining:				true,
+		WebServer:			true,
+		Clock:				util.RealClock{},
+		Output:				os.Stdout,
+	}
+}
+
+/*
+	DefaultRouteExpiry returns the route expiry used when none is configured. A route is only confirmed by the
+	packets of its destination, so routes only expire when route rumors are sent, every rtimer seconds
+ */
+func DefaultRouteExpiry(rtimer uint) uint {
+	if rtimer == 0 {
+		return 0
+	}
+	if expiry := constants.ROUTE_EXPIRY_RTIMERS * rtimer; expiry > constants.ROUTE_EXPIRY {
+		return expiry
+	}
+	return constants.ROUTE_EXPIRY
+}
@@ -0,0 +1,126 @@
+package gossiper
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/Theyiot/Peerster/constants"
+	"math/big"
+	"math/bits"
+)
+
+/*
+	ConsensusParams are the parameters of the proof of work that all the peers must agree on. The difficulty of a
+	block is the number of leading zero bits its hash must have. The first block has the genesis difficulty, and
+	every RetargetInterval blocks the difficulty is increased or decreased by one bit if the last blocks were mined
+	more than twice faster or slower than TargetBlockTime
+ */
+type ConsensusParams struct {
+	GenesisDifficulty	uint32
+	RetargetInterval	uint64
+	TargetBlockTime		int64
+}
+
+/*
+	BlockInfo contains what we compute about a block of our blockchain, namely its height (the first block has a
+	height of 1) and the cumulative work of the chain it ends
+ */
+type BlockInfo struct {
+	Height		uint64
+	Work		*big.Int
+}
+
+/*
+	createConsensusParams returns the consensus parameters for the given genesis difficulty
+ */
+func createConsensusParams(genesisDifficulty uint32) ConsensusParams {
+	return ConsensusParams{GenesisDifficulty: genesisDifficulty, RetargetInterval: constants.RETARGET_INTERVAL,
+		TargetBlockTime: constants.TARGET_BLOCK_TIME}
+}
+
+/*
+	expectedDifficulty returns the difficulty that the child of the given block must have
+ */
+func (gossiper *Gossiper) expectedDifficulty(prevHashHex string) uint32 {
+	consensus := gossiper.Consensus
+	parent, exist := gossiper.Blockchain.Load(prevHashHex)
+	if prevHashHex == constants.DEFAULT_BLOCK_HASH || !exist {
+		return consensus.GenesisDifficulty
+	}
+	parentBlock := parent.(Block)
+	parentInfo, _ := gossiper.getBlockInfo(prevHashHex)
+	if consensus.RetargetInterval < 2 || parentInfo.Height % consensus.RetargetInterval != 0 {
+		return parentBlock.Difficulty
+	}
+
+	// WE LOOK AT THE TIME IT TOOK TO MINE THE LAST RetargetInterval BLOCKS
+	first := parentBlock
+	for i := uint64(1) ; i < consensus.RetargetInterval ; i++ {
+		block, exist := gossiper.Blockchain.Load(hex.EncodeToString(first.PrevHash[:]))
+		if !exist {
+			return parentBlock.Difficulty
+		}
+		first = block.(Block)
+	}
+	actualTime := parentBlock.Timestamp - first.Timestamp
+	expectedTime := int64(consensus.RetargetInterval - 1) * consensus.TargetBlockTime
+
+	difficulty := parentBlock.Difficulty
+	if actualTime * 2 < expectedTime && difficulty < constants.MAX_DIFFICULTY {
+		difficulty++
+	} else if actualTime > expectedTime * 2 && difficulty > constants.MIN_DIFFICULTY {
+		difficulty--
+	}
+	return difficulty
+}
+
+/*
+	getBlockInfo returns the height and cumulative work of the given block. They are computed once for each block,
+	from the ones of its closest ancestor for which they are already known
+ */
+func (gossiper *Gossiper) getBlockInfo(hashHex string) (BlockInfo, bool) {
+	toCompute := make([]Block, 0)
+	info := BlockInfo{Height: 0, Work: big.NewInt(0)}
+	for hashHex != constants.DEFAULT_BLOCK_HASH {
+		if known, exist := gossiper.BlockInfos.Load(hashHex); exist {
+			info = known.(BlockInfo)
+			break
+		}
+		block, exist := gossiper.Blockchain.Load(hashHex)
+		if !exist {
+			return BlockInfo{}, false
+		}
+		toCompute = append(toCompute, block.(Block))
+		prevHash := block.(Block).PrevHash
+		hashHex = hex.EncodeToString(prevHash[:])
+	}
+
+	for i := len(toCompute) - 1 ; i >= 0 ; i-- {
+		block := toCompute[i]
+		work := new(big.Int).Add(info.Work, blockWork(block.Difficulty))
+		info = BlockInfo{Height: info.Height + 1, Work: work}
+		hash := block.Hash()
+		gossiper.BlockInfos.Store(hex.EncodeToString(hash[:]), info)
+	}
+	return info, true
+}
+
+/*
+	blockWork returns the expected number of hashes needed to mine a block with the given difficulty
+ */
+func blockWork(difficulty uint32) *big.Int {
+	return new(big.Int).Lsh(big.NewInt(1), uint(difficulty))
+}
+
+/*
+	hasValidProofOfWork checks that the hash of a block has at least the given number of leading zero bits
+ */
+func hasValidProofOfWork(hash [sha256.Size]byte, difficulty uint32) bool {
+	zeros := uint32(0)
+	for _, b := range hash {
+		zeros += uint32(bits.LeadingZeros8(b))
+		if b != 0 || zeros >= difficulty {
+			break
+		}
+	}
+	return zeros >= difficulty
+}
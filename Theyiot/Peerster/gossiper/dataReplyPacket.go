@@ -9,10 +9,46 @@ import (
 	receiveDataReplyPacket handles the packets of DataReply type.
  */
 func (gossiper *Gossiper) receiveDataReplyPacket(gossipPacket GossipPacket, addr *net.UDPAddr) {
+	dataReply := gossipPacket.DataReply
+	err := gossiper.verifyOrigin(dataReply.Origin, dataReply.PublicKey, dataReply.signedContent(), dataReply.Signature)
+	if err != nil {
+		println("ERROR : rejecting data reply from " + addr.String() + " : " + err.Error())
+		return
+	}
+
+	//DATA REPLY IS NOT DESTINED TO US
+	if dataReply.Destination != gossiper.Name {
+		gossiper.forwardDataReplyPacket(gossipPacket, addr.String())
+		return
+	}
+
 	fileChannel, exist := gossiper.ReceivingFile.Load(hex.EncodeToString(gossipPacket.DataReply.HashValue))
 	if !exist {
 		return
 	}
 
-	fileChannel.(chan[]byte) <- gossipPacket.DataReply.Data
+	select { // NON-BLOCKING SEND, THE REQUEST MAY ALREADY HAVE BEEN ANSWERED
+	case fileChannel.(chan[]byte) <- gossipPacket.DataReply.Data:
+	default:
+	}
+}
+
+/*
+	forwardDataReplyPacket takes care of forwarding a point-to-point data reply to the right peer
+ */
+func (gossiper *Gossiper) forwardDataReplyPacket(gossipPacket GossipPacket, senderAddr string) {
+	//WE DECREASE AND DISCARD INVALID PACKET
+	gossipPacket.DataReply.HopLimit--
+	if gossipPacket.DataReply.HopLimit == 0 {
+		return
+	}
+
+	nextHopAddr, exist := gossiper.DSDV.GetNextHop(gossipPacket.DataReply.Destination)
+	if !exist {
+		println("ERROR : don't know how to forward to " + gossipPacket.DataReply.Destination)
+		return
+	}
+
+	packetToSend := PacketToSend{Address: nextHopAddr, GossipPacket: &gossipPacket}
+	gossiper.send(packetToSend)
 }
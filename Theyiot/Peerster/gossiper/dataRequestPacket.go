@@ -22,9 +22,16 @@ func (gossiper *Gossiper) receiveDataRequestPacket(gossipPacket GossipPacket, ad
 		return
 	}
 
+	// THE REPLY GOES BACK HOP BY HOP, SO THE REQUEST TEACHES US UNKNOWN OR SHORTER ROUTES TOWARDS ITS ORIGIN
+	if hopLimit := gossipPacket.DataRequest.HopLimit; hopLimit <= constants.DEFAULT_HOP_LIMIT {
+		hops := constants.DEFAULT_HOP_LIMIT - hopLimit + 1
+		gossiper.updateRoute(gossipPacket.DataRequest.Origin, addr, 0, hops, constants.ROUTE_FROM_DATA_REQUEST)
+	}
+
 	//FILE REQUEST IS NOT DESTINED TO US
 	if dest != gossiper.Name {
 		gossiper.forwardDataRequestPacket(gossipPacket, addr.String())
+		return
 	}
 
 	//REQUESTED HASH CORRESPONDS TO A METAFILE
@@ -36,9 +43,10 @@ func (gossiper *Gossiper) receiveDataRequestPacket(gossipPacket GossipPacket, ad
 	if util.CheckAndPrintError(err) {
 		return
 	}
-	dataReply := DataReply{HashValue: hash, HopLimit: constants.DEFAULT_HOP_LIMIT, Destination: dest,
-		Origin: gossiper.Name, Data: data}
-	gossiper.ToSend <- PacketToSend{GossipPacket: &GossipPacket{DataReply: &dataReply}, Address: addr}
+	dataReply := DataReply{HashValue: hash, HopLimit: constants.DEFAULT_HOP_LIMIT,
+		Destination: gossipPacket.DataRequest.Origin, Origin: gossiper.Name, Data: data}
+	gossiper.signDataReply(&dataReply)
+	gossiper.send(PacketToSend{GossipPacket: &GossipPacket{DataReply: &dataReply}, Address: addr})
 }
 
 /*
@@ -51,14 +59,14 @@ func (gossiper *Gossiper) forwardDataRequestPacket(gossipPacket GossipPacket, se
 		return
 	}
 
-	nextHopAddr, exist := gossiper.DSDV.Load(gossipPacket.DataRequest.Destination)
+	nextHopAddr, exist := gossiper.DSDV.GetNextHop(gossipPacket.DataRequest.Destination)
 	if !exist {
 		println("ERROR : don't know how to forward to " + gossipPacket.DataRequest.Destination)
 		return
 	}
 
-	packetToSend := PacketToSend{Address: nextHopAddr.(*net.UDPAddr), GossipPacket: &gossipPacket}
-	gossiper.ToSend <- packetToSend
+	packetToSend := PacketToSend{Address: nextHopAddr, GossipPacket: &gossipPacket}
+	gossiper.send(packetToSend)
 }
 
 /*
@@ -68,20 +76,25 @@ func (gossiper *Gossiper) forwardDataRequestPacket(gossipPacket GossipPacket, se
 func (gossiper *Gossiper) sendDataRequest(hash []byte, dest string, addr *net.UDPAddr, fileChannel chan[]byte) ([]byte, error) {
 	dataRequest := DataRequest{HashValue: hash, HopLimit: constants.DEFAULT_HOP_LIMIT, Destination: dest,
 		Origin: gossiper.Name}
-	gossiper.ToSend <- PacketToSend{GossipPacket: &GossipPacket{DataRequest: &dataRequest}, Address: addr}
+	gossiper.send(PacketToSend{GossipPacket: &GossipPacket{DataRequest: &dataRequest}, Address: addr})
 
 	// WE TRY TO SEND THE DATA REQUEST 10 TIMES, IT PROBABLY WON'T SUCCESS IF IT FAILED THIS NUMBER OF TIME
 	i, numberOfTries := 0, 10
 	for i < numberOfTries {
-		timer := time.NewTimer(5 * time.Second)
+		timer := gossiper.Clock.NewTimer(5 * time.Second)
 
 		select {
 		case fileChunk := <- fileChannel:
+			timer.Stop()
 			util.CheckAndPrintError(writeChunk(hex.EncodeToString(hash), fileChunk))
 			return fileChunk, nil
 
 		case <- timer.C:
-			gossiper.ToSend <- PacketToSend{GossipPacket: &GossipPacket{DataRequest: &dataRequest}, Address: addr}
+			gossiper.send(PacketToSend{GossipPacket: &GossipPacket{DataRequest: &dataRequest}, Address: addr})
+
+		case <- gossiper.Done():
+			timer.Stop()
+			return []byte{}, errors.New("the gossiper was stopped while waiting for " + hex.EncodeToString(hash))
 		}
 		i++
 	}
@@ -0,0 +1,228 @@
+package gossiper
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Theyiot/Peerster/constants"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/*
+	A DownloadJournal keeps track of the progress of a download, so that it can be resumed after a timeout or a
+	restart of the gossiper. It is stored in the "._DownloadJournals" folder, in a file named after the metaHash
+	of the downloaded file. The first line of that file is the JSON encoding of the journal and every following
+	line is the index of a chunk that was verified and stored in the "._FileChunks" folder
+ */
+type DownloadJournal struct {
+	FileName		string
+	MetaHashHex		string
+	Destinations	[]string
+	verified		map[uint64]bool
+	file			*os.File
+	lock			sync.RWMutex
+}
+
+/*
+	openDownloadJournal opens the journal of the download for the given metaHash, or creates it if there is none
+	yet. The given destinations are added to the ones that were already known by the journal
+ */
+func openDownloadJournal(fileName, metaHashHex string, destinations []string) (*DownloadJournal, error) {
+	journal, err := loadDownloadJournal(metaHashHex)
+	if os.IsNotExist(err) {
+		journal = &DownloadJournal{MetaHashHex: metaHashHex, Destinations: make([]string, 0),
+			verified: make(map[uint64]bool)}
+	} else if err != nil {
+		return nil, err
+	}
+	if fileName != "" {
+		journal.FileName = fileName
+	}
+	for _, destination := range destinations {
+		journal.addDestination(destination)
+	}
+
+	if err := journal.rewrite(); err != nil {
+		return nil, err
+	}
+	return journal, nil
+}
+
+/*
+	loadDownloadJournal reads the journal of the download for the given metaHash from the disk. A last line that
+	is not complete (because the gossiper stopped while writing it) is harmless, since chunks are checked against
+	their hash again before being reused
+ */
+func loadDownloadJournal(metaHashHex string) (*DownloadJournal, error) {
+	file, err := os.Open(constants.PATH_DOWNLOAD_JOURNALS + metaHashHex)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	if !scanner.Scan() {
+		return nil, errors.New("download journal " + metaHashHex + " is empty")
+	}
+	journal := &DownloadJournal{verified: make(map[uint64]bool)}
+	if err := json.Unmarshal(scanner.Bytes(), journal); err != nil {
+		return nil, err
+	}
+	if journal.MetaHashHex != metaHashHex {
+		return nil, errors.New("download journal " + metaHashHex + " belongs to " + journal.MetaHashHex)
+	}
+	for scanner.Scan() {
+		index, err := strconv.ParseUint(strings.TrimSpace(scanner.Text()), 10, 64)
+		if err != nil {
+			break
+		}
+		journal.verified[index] = true
+	}
+	return journal, nil
+}
+
+/*
+	listDownloadJournals returns the metaHashes of all the downloads that have a journal on the disk
+ */
+func listDownloadJournals() []string {
+	metaHashes := make([]string, 0)
+	dir, err := os.Open(constants.PATH_DOWNLOAD_JOURNALS)
+	if err != nil {
+		return metaHashes
+	}
+	defer dir.Close()
+	names, err := dir.Readdirnames(0)
+	if err != nil {
+		return metaHashes
+	}
+	for _, name := range names {
+		if IsHexHash(name) {
+			metaHashes = append(metaHashes, name)
+		}
+	}
+	return metaHashes
+}
+
+/*
+	MarkVerified records that the i-th chunk of the file has been verified and stored
+ */
+func (journal *DownloadJournal) MarkVerified(i uint64) error {
+	journal.lock.Lock()
+	defer journal.lock.Unlock()
+	if journal.verified[i] {
+		return nil
+	}
+	if journal.file == nil {
+		return errors.New("download journal " + journal.MetaHashHex + " is closed")
+	}
+	if _, err := journal.file.WriteString(fmt.Sprint(i) + "\n"); err != nil {
+		return err
+	}
+	journal.verified[i] = true
+	return nil
+}
+
+/*
+	IsVerified returns whether the i-th chunk of the file has already been verified and stored
+ */
+func (journal *DownloadJournal) IsVerified(i uint64) bool {
+	journal.lock.RLock()
+	defer journal.lock.RUnlock()
+	return journal.verified[i]
+}
+
+/*
+	VerifiedCount returns the number of chunks that have already been verified and stored
+ */
+func (journal *DownloadJournal) VerifiedCount() int {
+	journal.lock.RLock()
+	defer journal.lock.RUnlock()
+	return len(journal.verified)
+}
+
+/*
+	GetDestinations returns a copy of the peers the file has been downloaded from
+ */
+func (journal *DownloadJournal) GetDestinations() []string {
+	journal.lock.RLock()
+	defer journal.lock.RUnlock()
+	destinations := make([]string, len(journal.Destinations))
+	copy(destinations, journal.Destinations)
+	return destinations
+}
+
+/*
+	Close closes the journal, which stays on the disk so that the download can be resumed later
+ */
+func (journal *DownloadJournal) Close() {
+	journal.lock.Lock()
+	defer journal.lock.Unlock()
+	if journal.file != nil {
+		journal.file.Close()
+		journal.file = nil
+	}
+}
+
+/*
+	Remove closes the journal and deletes it from the disk, once the download is complete
+ */
+func (journal *DownloadJournal) Remove() {
+	journal.Close()
+	os.Remove(constants.PATH_DOWNLOAD_JOURNALS + journal.MetaHashHex)
+}
+
+/*
+	addDestination adds a peer to the destinations of the journal, if it was not already there
+ */
+func (journal *DownloadJournal) addDestination(destination string) {
+	for _, known := range journal.Destinations {
+		if known == destination {
+			return
+		}
+	}
+	journal.Destinations = append(journal.Destinations, destination)
+}
+
+/*
+	rewrite writes the whole journal in a temporary file, which then replaces the old one, and keeps it open so
+	that the chunks verified afterwards can simply be appended to it
+ */
+func (journal *DownloadJournal) rewrite() error {
+	journal.lock.Lock()
+	defer journal.lock.Unlock()
+	if err := os.MkdirAll(constants.PATH_DOWNLOAD_JOURNALS, os.ModePerm); err != nil {
+		return err
+	}
+	header, err := json.Marshal(journal)
+	if err != nil {
+		return err
+	}
+	path := constants.PATH_DOWNLOAD_JOURNALS + journal.MetaHashHex
+	tmpFile, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(tmpFile)
+	writer.Write(append(header, '\n'))
+	for index := range journal.verified {
+		writer.WriteString(fmt.Sprint(index) + "\n")
+	}
+	if err := writer.Flush(); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	tmpFile.Close()
+	if err := os.Rename(path + ".tmp", path); err != nil {
+		return err
+	}
+
+	if journal.file != nil {
+		journal.file.Close()
+	}
+	journal.file, err = os.OpenFile(path, os.O_APPEND | os.O_WRONLY, 0644)
+	return err
+}
@@ -0,0 +1,267 @@
+package gossiper
+
+import (
+	"encoding/hex"
+	"errors"
+	"github.com/Theyiot/Peerster/constants"
+	"github.com/Theyiot/Peerster/util"
+	"math/rand"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+/*
+	A downloadScheduler downloads the chunks of a file from the peers that own them. It keeps at most window
+	DataRequests outstanding at the same time, spreads them over all the owners of each chunk and stops asking
+	the peers that time out or send invalid chunks when other owners are available. Since the chunks may arrive
+	in any order, each of them is written directly at its offset in the file
+ */
+type downloadScheduler struct {
+	gossiper	*Gossiper
+	journal		*DownloadJournal
+	file		*os.File
+	owners		func(i int) []string
+	window		int
+	peers		map[string]*peerLoad
+	fileSize	int64
+	lock		sync.Mutex
+}
+
+/*
+	A chunkJob is a chunk to download. Since a file may contain the same chunk multiple times, a job has all the
+	indexes at which its data must be written
+ */
+type chunkJob struct {
+	hash		[]byte
+	indexes		[]int
+	attempts	int
+	success		bool
+}
+
+/*
+	peerLoad counts the requests that are outstanding for a peer and the ones it failed to answer
+ */
+type peerLoad struct {
+	outstanding		int
+	failures		int
+}
+
+/*
+	newDownloadScheduler creates a scheduler that writes the chunks in the given file and records them in the
+	journal. owners returns the peers that own the i-th chunk of the file
+ */
+func newDownloadScheduler(gossiper *Gossiper, journal *DownloadJournal, file *os.File, owners func(i int) []string) *downloadScheduler {
+	window := int(gossiper.DownloadWindow)
+	if window < 1 {
+		window = 1
+	}
+	return &downloadScheduler{gossiper: gossiper, journal: journal, file: file, owners: owners, window: window,
+		peers: make(map[string]*peerLoad)}
+}
+
+/*
+	run downloads all the chunks with the given hashes, except the ones that the journal marks as verified and that
+	are still in the "._FileChunks" folder, and returns the size of the file. It returns an error as soon as one
+	chunk could not be obtained after constants.MAX_CHUNK_ATTEMPTS attempts
+ */
+func (scheduler *downloadScheduler) run(hashes [][]byte) (int64, error) {
+	jobsByHash := make(map[string]*chunkJob)
+	jobsList := make([]*chunkJob, 0)
+	for i, hash := range hashes {
+		hashHex := hex.EncodeToString(hash)
+		if scheduler.journal.IsVerified(uint64(i)) {
+			if chunk, success := readVerifiedChunk(hashHex); success {
+				if err := scheduler.writeAt(chunk, i); err != nil {
+					return 0, err
+				}
+				continue
+			}
+		}
+		if job, exist := jobsByHash[hashHex]; exist {
+			job.indexes = append(job.indexes, i)
+			continue
+		}
+		job := &chunkJob{hash: hash, indexes: []int{i}}
+		jobsByHash[hashHex] = job
+		jobsList = append(jobsList, job)
+	}
+	if len(jobsList) == 0 {
+		return scheduler.fileSize, nil
+	}
+
+	jobs := make(chan *chunkJob, len(jobsList))
+	results := make(chan *chunkJob, len(jobsList))
+	done := make(chan Signal)
+	for _, job := range jobsList {
+		jobs <- job
+	}
+
+	// A JOB IS PUT BACK IN THE QUEUE UNTIL IT SUCCEEDS OR HAS BEEN TRIED TOO MANY TIMES
+	var workers sync.WaitGroup
+	for w := 0 ; w < scheduler.window && w < len(jobsList) ; w++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for {
+				select {
+				case <- done:
+					return
+				case job := <- jobs:
+					job.success = scheduler.fetch(job)
+					if job.success || job.attempts >= constants.MAX_CHUNK_ATTEMPTS {
+						results <- job
+					} else {
+						jobs <- job
+					}
+				}
+			}
+		}()
+	}
+
+	var err error
+	for finished := 0 ; finished < len(jobsList) && err == nil ; finished++ {
+		job := <- results
+		if !job.success {
+			err = errors.New("no peer sent chunk " + strconv.Itoa(job.indexes[0] + 1) + " after " +
+				strconv.Itoa(job.attempts) + " attempts")
+		}
+	}
+	close(done)
+	workers.Wait()
+	return scheduler.fileSize, err
+}
+
+/*
+	fetch sends one DataRequest for the given job to the best owner of the chunk and waits for the reply. It returns
+	true if the chunk was received, verified and written, and false if the job must be retried
+ */
+func (scheduler *downloadScheduler) fetch(job *chunkJob) bool {
+	job.attempts++
+	gossiper := scheduler.gossiper
+	peer := scheduler.choosePeer(job)
+	if peer == "" {
+		gossiper.Clock.Sleep(constants.DATA_REQUEST_TIMEOUT * time.Second)
+		return false
+	}
+	defer scheduler.release(peer)
+	addr, exist := gossiper.DSDV.GetNextHop(peer)
+	if !exist {
+		scheduler.penalize(peer)
+		return false
+	}
+
+	hashHex := hex.EncodeToString(job.hash)
+	gossiper.publish(ChunkRequested{ FileName: scheduler.journal.FileName, Chunk: job.indexes[0] + 1, From: peer })
+	fileChannel := make(chan []byte, 1)
+	gossiper.ReceivingFile.Store(hashHex, fileChannel)
+	defer gossiper.ReceivingFile.Delete(hashHex)
+
+	dataRequest := DataRequest{HashValue: job.hash, HopLimit: constants.DEFAULT_HOP_LIMIT, Destination: peer,
+		Origin: gossiper.Name}
+	gossiper.send(PacketToSend{GossipPacket: &GossipPacket{DataRequest: &dataRequest}, Address: addr})
+
+	timer := gossiper.Clock.NewTimer(constants.DATA_REQUEST_TIMEOUT * time.Second)
+	defer timer.Stop()
+	select {
+	case chunk := <- fileChannel:
+		if !checkAndPrintSameHash(hashHex, chunk) {
+			scheduler.penalize(peer)
+			return false
+		}
+		if util.CheckAndPrintError(writeChunk(hashHex, chunk)) {
+			return false
+		}
+		for _, i := range job.indexes {
+			if util.CheckAndPrintError(scheduler.writeAt(chunk, i)) {
+				return false
+			}
+			util.CheckAndPrintError(scheduler.journal.MarkVerified(uint64(i)))
+		}
+		gossiper.publish(ChunkDownloaded{ FileName: scheduler.journal.FileName, Chunk: job.indexes[0] + 1, From: peer,
+			Hash: hashHex })
+		return true
+
+	case <- timer.C:
+		scheduler.penalize(peer)
+		return false
+
+	case <- gossiper.Done():
+		return false
+	}
+}
+
+/*
+	choosePeer returns the owner of the chunk to which we should send the next request, namely a reachable peer
+	with the smallest number of failures and of outstanding requests. Ties are broken at random. It returns the
+	empty string if no owner is reachable
+ */
+func (scheduler *downloadScheduler) choosePeer(job *chunkJob) string {
+	candidates := make([]string, 0)
+	for _, i := range job.indexes {
+		candidates = append(candidates, scheduler.owners(i)...)
+	}
+
+	scheduler.lock.Lock()
+	defer scheduler.lock.Unlock()
+	best, bestScore := make([]string, 0), -1
+	for _, peer := range candidates {
+		if _, exist := scheduler.gossiper.DSDV.GetNextHop(peer); !exist {
+			continue
+		}
+		load, exist := scheduler.peers[peer]
+		if !exist {
+			load = &peerLoad{}
+			scheduler.peers[peer] = load
+		}
+		score := load.failures * scheduler.window + load.outstanding
+		if bestScore < 0 || score < bestScore {
+			best, bestScore = []string{peer}, score
+		} else if score == bestScore {
+			best = append(best, peer)
+		}
+	}
+	if len(best) == 0 {
+		return ""
+	}
+	peer := best[rand.Intn(len(best))]
+	scheduler.peers[peer].outstanding++
+	return peer
+}
+
+/*
+	release records that a request to the given peer is not outstanding anymore
+ */
+func (scheduler *downloadScheduler) release(peer string) {
+	scheduler.lock.Lock()
+	defer scheduler.lock.Unlock()
+	scheduler.peers[peer].outstanding--
+}
+
+/*
+	penalize records that the given peer failed to answer a request correctly, so that the following requests
+	are preferably sent to other owners
+ */
+func (scheduler *downloadScheduler) penalize(peer string) {
+	scheduler.lock.Lock()
+	defer scheduler.lock.Unlock()
+	scheduler.peers[peer].failures++
+}
+
+/*
+	writeAt writes the i-th chunk of the file at its offset. Every chunk except the last one has a size of exactly
+	constants.CHUNK_SIZE bytes
+ */
+func (scheduler *downloadScheduler) writeAt(chunk []byte, i int) error {
+	n, err := scheduler.file.WriteAt(chunk, int64(i) * constants.CHUNK_SIZE)
+	if err != nil {
+		return err
+	} else if n != len(chunk) {
+		return errors.New("the method write did not write the entire buffer")
+	}
+	scheduler.lock.Lock()
+	scheduler.fileSize += int64(n)
+	scheduler.lock.Unlock()
+	return nil
+}
@@ -0,0 +1,110 @@
+package gossiper
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/Theyiot/Peerster/constants"
+)
+
+/*
+	encrypt replaces the text of a private message by its encryption for the given X25519 public key. A new
+	ephemeral key pair is used for every message, and the text is sealed with AES-GCM so that it can not be
+	modified on the way. The origin and the destination are authenticated as well
+ */
+func (private *PrivateMessage) encrypt(recipientKey []byte) error {
+	publicKey, err := ecdh.X25519().NewPublicKey(recipientKey)
+	if err != nil {
+		return err
+	}
+	ephemeralKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	sharedSecret, err := ephemeralKey.ECDH(publicKey)
+	if err != nil {
+		return err
+	}
+	aead, err := createPrivateCipher(sharedSecret, ephemeralKey.PublicKey().Bytes(), recipientKey)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	private.EncryptedText = aead.Seal(nil, nonce, []byte(private.Text), private.additionalData())
+	private.EphemeralKey = ephemeralKey.PublicKey().Bytes()
+	private.Nonce = nonce
+	private.Text = ""
+	return nil
+}
+
+/*
+	decryptPrivate returns the text of a private message that was encrypted for this identity
+ */
+func (identity *Identity) decryptPrivate(private *PrivateMessage) (string, error) {
+	ephemeralKey, err := ecdh.X25519().NewPublicKey(private.EphemeralKey)
+	if err != nil {
+		return "", err
+	}
+	sharedSecret, err := identity.encryptionPrivateKey.ECDH(ephemeralKey)
+	if err != nil {
+		return "", err
+	}
+	aead, err := createPrivateCipher(sharedSecret, private.EphemeralKey, identity.EncryptionKey)
+	if err != nil {
+		return "", err
+	}
+	if len(private.Nonce) != aead.NonceSize() {
+		return "", errors.New("the nonce of the private message has a wrong size")
+	}
+	text, err := aead.Open(nil, private.Nonce, private.EncryptedText, private.additionalData())
+	if err != nil {
+		return "", err
+	}
+	return string(text), nil
+}
+
+/*
+	createPrivateCipher returns the AES-GCM cipher whose key is derived from the X25519 shared secret and from the
+	two public keys that produced it
+ */
+func createPrivateCipher(sharedSecret, ephemeralKey, recipientKey []byte) (cipher.AEAD, error) {
+	key := sha256.Sum256(concatFields(constants.ENCRYPTION_KEY_DOMAIN, sharedSecret, ephemeralKey, recipientKey))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+/*
+	additionalData returns the fields of a private message that are authenticated, but not encrypted, by AES-GCM
+ */
+func (private *PrivateMessage) additionalData() []byte {
+	return concatFields("PRIVATE", []byte(private.Origin), []byte(private.Destination))
+}
+
+/*
+	storeEncryptionKey records the X25519 public key that a peer announced in one of its signed rumors
+ */
+func (gossiper *Gossiper) storeEncryptionKey(origin string, encryptionKey []byte) {
+	if _, err := ecdh.X25519().NewPublicKey(encryptionKey); err != nil {
+		return
+	}
+	knownKey, exist := gossiper.EncryptionKeys.Load(origin)
+	if exist && bytes.Equal(knownKey.([]byte), encryptionKey) {
+		return
+	}
+	keyCopy := make([]byte, len(encryptionKey))
+	copy(keyCopy, encryptionKey)
+	gossiper.EncryptionKeys.Store(origin, keyCopy)
+	gossiper.persist(constants.BUCKET_ENCRYPTION_KEYS, origin, hex.EncodeToString(keyCopy))
+}
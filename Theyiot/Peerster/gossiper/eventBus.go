@@ -0,0 +1,147 @@
+package gossiper
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+/*
+	An EventBus delivers the events of a gossiper to its subscribers. Each subscriber receives the events published
+	after it subscribed, in the order they were published by a given routine. Publishing never waits for a
+	subscriber : the events that do not fit in the buffer of a lagging subscriber are dropped and counted, unless it
+	subscribed with SubscribeLossless
+ */
+type EventBus struct {
+	subscribers		map[uint64]*subscription
+	nextID			uint64
+	dropped			uint64
+	lock			sync.RWMutex
+}
+
+/*
+	A subscription is the channel of a subscriber. The events of a lossless subscription are queued without bound
+	until forward hands them to the channel
+ */
+type subscription struct {
+	events			chan Event
+	lossless		bool
+	queue			[]Event
+	ready			chan struct{}
+	done			chan struct{}
+	lock			sync.Mutex
+}
+
+/*
+	Subscribe returns a channel on which the events are delivered, with room for buffer of them, and a function to
+	call to unsubscribe. The events published while the buffer is full are dropped. The channel is never closed
+ */
+func (bus *EventBus) Subscribe(buffer int) (<-chan Event, func()) {
+	return bus.subscribe(&subscription{ events: make(chan Event, buffer) })
+}
+
+/*
+	SubscribeLossless returns a channel on which every event is delivered, and a function to call to unsubscribe.
+	The events wait in a queue until they are received, so the subscriber must keep receiving them. The channel is
+	never closed
+ */
+func (bus *EventBus) SubscribeLossless() (<-chan Event, func()) {
+	sub := &subscription{ events: make(chan Event), lossless: true, ready: make(chan struct{}, 1),
+		done: make(chan struct{}) }
+	go sub.forward()
+	return bus.subscribe(sub)
+}
+
+/*
+	subscribe adds the subscription to the bus, and returns its channel and the function removing it
+ */
+func (bus *EventBus) subscribe(sub *subscription) (<-chan Event, func()) {
+	bus.lock.Lock()
+	defer bus.lock.Unlock()
+	id := bus.nextID
+	bus.nextID++
+	bus.subscribers[id] = sub
+
+	return sub.events, func() {
+		bus.lock.Lock()
+		delete(bus.subscribers, id)
+		bus.lock.Unlock()
+		if sub.lossless {
+			close(sub.done)
+		}
+	}
+}
+
+/*
+	Dropped returns the number of events that were dropped because the buffer of a subscriber was full
+ */
+func (bus *EventBus) Dropped() uint64 {
+	return atomic.LoadUint64(&bus.dropped)
+}
+
+/*
+	publish delivers the event to every subscriber that has room for it in its buffer, and queues it for the
+	lossless ones
+ */
+func (bus *EventBus) publish(event Event) {
+	bus.lock.RLock()
+	defer bus.lock.RUnlock()
+	for _, sub := range bus.subscribers {
+		if sub.lossless {
+			sub.enqueue(event)
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			atomic.AddUint64(&bus.dropped, 1)
+		}
+	}
+}
+
+/*
+	enqueue adds the event to the queue of a lossless subscription, and wakes up its forward routine
+ */
+func (sub *subscription) enqueue(event Event) {
+	sub.lock.Lock()
+	sub.queue = append(sub.queue, event)
+	sub.lock.Unlock()
+	select {
+	case sub.ready <- struct{}{}:
+	default:
+	}
+}
+
+/*
+	forward hands the queued events of a lossless subscription to its channel, in order, until it is unsubscribed
+ */
+func (sub *subscription) forward() {
+	for {
+		sub.lock.Lock()
+		if len(sub.queue) == 0 {
+			sub.lock.Unlock()
+			select {
+			case <- sub.ready:
+				continue
+			case <- sub.done:
+				return
+			}
+		}
+		event := sub.queue[0]
+		sub.queue[0] = nil
+		sub.queue = sub.queue[1:]
+		sub.lock.Unlock()
+
+		select {
+		case sub.events <- event:
+		case <- sub.done:
+			return
+		}
+	}
+}
+
+/*
+	createEventBus creates an EventBus without any subscriber
+ */
+func createEventBus() *EventBus {
+	return &EventBus{ subscribers: make(map[uint64]*subscription) }
+}
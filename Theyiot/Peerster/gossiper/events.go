@@ -0,0 +1,377 @@
+package gossiper
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/*
+	An Event is something observable that happened in the gossiper. Text returns the line printed on the console
+	for the event, or an empty string if the event is not printed
+ */
+type Event interface {
+	Text() string
+}
+
+/*
+	peersText returns the list of peers as it is printed after some events
+ */
+func peersText(peers []string) string {
+	return "\nPEERS " + strings.Join(peers, ",")
+}
+
+/*
+	ClientMessageReceived is published when the client asks us to send a message, whether simple, rumor or private
+ */
+type ClientMessageReceived struct {
+	Contents		string
+	Peers			[]string
+}
+
+func (event ClientMessageReceived) Text() string {
+	return "CLIENT MESSAGE " + event.Contents + peersText(event.Peers)
+}
+
+/*
+	SimpleMessageReceived is published when we receive a message in simple broadcast mode
+ */
+type SimpleMessageReceived struct {
+	Origin			string
+	RelayAddr		string
+	Contents		string
+	Peers			[]string
+}
+
+func (event SimpleMessageReceived) Text() string {
+	return "SIMPLE MESSAGE origin " + event.Origin + " from " + event.RelayAddr + " contents " + event.Contents +
+		peersText(event.Peers)
+}
+
+/*
+	RumorReceived is published when we receive a rumor we did not know yet
+ */
+type RumorReceived struct {
+	Origin			string
+	From			string
+	ID				uint32
+	Contents		string
+	Peers			[]string
+}
+
+func (event RumorReceived) Text() string {
+	return "RUMOR origin " + event.Origin + " from " + event.From + " ID " + fmt.Sprint(event.ID) + " contents " +
+		event.Contents + peersText(event.Peers)
+}
+
+/*
+	InSyncWithPeer is published when a status packet of a peer shows that we both know the same rumors. Status only
+	holds the origins from which the peer received rumors
+ */
+type InSyncWithPeer struct {
+	From			string
+	Status			[]PeerStatus
+	Peers			[]string
+}
+
+func (event InSyncWithPeer) Text() string {
+	str := "STATUS from " + event.From
+	for _, status := range event.Status {
+		str += " peer " + status.Identifier + " nextID " + fmt.Sprint(status.NextID)
+	}
+	return str + peersText(event.Peers) + "\nIN SYNC WITH " + event.From
+}
+
+/*
+	MongeringStarted is published when we send a rumor to a peer and wait for its status
+ */
+type MongeringStarted struct {
+	Peer			string
+}
+
+func (event MongeringStarted) Text() string {
+	return "MONGERING with " + event.Peer
+}
+
+/*
+	CoinFlipped is published when the coin toss at the end of a rumormongering tells us to go on with another peer
+ */
+type CoinFlipped struct {
+	Peer			string
+}
+
+func (event CoinFlipped) Text() string {
+	return "FLIPPED COIN sending rumor to " + event.Peer
+}
+
+/*
+	PeerStateChanged is published when a peer becomes alive, suspect or dead, and when a dead peer is forgotten
+ */
+type PeerStateChanged struct {
+	Address			string
+	State			string
+}
+
+func (event PeerStateChanged) Text() string {
+	return "PEER " + event.Address + " " + event.State
+}
+
+/*
+	PeersExchanged is published when a peer exchange teaches us new peers
+ */
+type PeersExchanged struct {
+	From			string
+	Added			[]string
+	Peers			[]string
+}
+
+func (event PeersExchanged) Text() string {
+	return "PEER-EXCHANGE from " + event.From + " added " + strings.Join(event.Added, ",") + peersText(event.Peers)
+}
+
+/*
+	PrivateReceived is published when we receive a private message destined to us
+ */
+type PrivateReceived struct {
+	Origin			string
+	HopLimit		uint32
+	Contents		string
+	Peers			[]string
+}
+
+func (event PrivateReceived) Text() string {
+	return "PRIVATE origin " + event.Origin + " hop-limit " + fmt.Sprint(event.HopLimit) + " contents " +
+		event.Contents + peersText(event.Peers)
+}
+
+/*
+	PrivateQueued is published when one of our private messages waits in the mailbox for a route to its destination
+ */
+type PrivateQueued struct {
+	ID				uint32
+	Destination		string
+}
+
+func (event PrivateQueued) Text() string {
+	return "QUEUED private message " + fmt.Sprint(event.ID) + " for " + event.Destination
+}
+
+/*
+	PrivateAcknowledged is published when the destination of one of our private messages acknowledges it
+ */
+type PrivateAcknowledged struct {
+	Origin			string
+	ID				uint32
+}
+
+func (event PrivateAcknowledged) Text() string {
+	return "PRIVATE-ACK origin " + event.Origin + " ID " + fmt.Sprint(event.ID)
+}
+
+/*
+	MailboxDeposited is published when a peer asks us to keep a private message it could not deliver
+ */
+type MailboxDeposited struct {
+	Origin			string
+	Destination		string
+}
+
+func (event MailboxDeposited) Text() string {
+	return "MAILBOX deposit from " + event.Origin + " for " + event.Destination
+}
+
+/*
+	IdentityLearned is published when we learn the public key of an origin for the first time
+ */
+type IdentityLearned struct {
+	Origin			string
+	PublicKey		[]byte
+}
+
+func (event IdentityLearned) Text() string {
+	return "IDENTITY " + event.Origin + " " + hex.EncodeToString(event.PublicKey)
+}
+
+/*
+	RouteUpdated is published when we learn a route to a new destination, or a route through another next hop
+ */
+type RouteUpdated struct {
+	Destination		string
+	NextHop			string
+	Seq				uint32
+	Hops			uint32
+	LearnedFrom		string
+}
+
+func (event RouteUpdated) Text() string {
+	return "DSDV " + event.Destination + " " + event.NextHop
+}
+
+/*
+	RouteExpired is published when a route is removed because it was not confirmed for too long
+ */
+type RouteExpired struct {
+	Destination		string
+}
+
+func (event RouteExpired) Text() string {
+	return "DSDV-EXPIRED " + event.Destination
+}
+
+/*
+	NameResolved is published when a file name is resolved to its metafile through the blockchain
+ */
+type NameResolved struct {
+	FileName		string
+	MetaHash		string
+}
+
+func (event NameResolved) Text() string {
+	return "RESOLVED " + event.FileName + " metafile=" + event.MetaHash
+}
+
+/*
+	MetaFileRequested is published when we request the metafile of a file we download
+ */
+type MetaFileRequested struct {
+	FileName		string
+	From			string
+}
+
+func (event MetaFileRequested) Text() string {
+	return "DOWNLOADING metafile of " + event.FileName + " from " + event.From
+}
+
+/*
+	ChunkRequested is published when we request a chunk of a file we download. Chunks are numbered from 1
+ */
+type ChunkRequested struct {
+	FileName		string
+	Chunk			int
+	From			string
+}
+
+func (event ChunkRequested) Text() string {
+	return "DOWNLOADING " + event.FileName + " chunk " + strconv.Itoa(event.Chunk) + " from " + event.From
+}
+
+/*
+	ChunkDownloaded is published when a chunk we requested was received and verified. Chunks are numbered from 1.
+	It is not printed
+ */
+type ChunkDownloaded struct {
+	FileName		string
+	Chunk			int
+	From			string
+	Hash			string
+}
+
+func (event ChunkDownloaded) Text() string {
+	return ""
+}
+
+/*
+	DownloadResumed is published when we resume an interrupted download. Chunks are numbered from 1
+ */
+type DownloadResumed struct {
+	FileName		string
+	FirstMissing	int
+}
+
+func (event DownloadResumed) Text() string {
+	return "RESUMING " + event.FileName + " from chunk " + strconv.Itoa(event.FirstMissing)
+}
+
+/*
+	FileReconstructed is published when all the chunks of a file were downloaded
+ */
+type FileReconstructed struct {
+	FileName		string
+}
+
+func (event FileReconstructed) Text() string {
+	return "RECONSTRUCTED file " + event.FileName
+}
+
+/*
+	SearchMatched is published when a search reply tells us that a peer has chunks of a matching file
+ */
+type SearchMatched struct {
+	FileName		string
+	Origin			string
+	MetaHash		string
+	Chunks			[]uint64
+}
+
+func (event SearchMatched) Text() string {
+	chunks := make([]string, len(event.Chunks))
+	for i, chunk := range event.Chunks {
+		chunks[i] = fmt.Sprint(chunk)
+	}
+	return "FOUND match " + event.FileName + " at " + event.Origin + " metafile=" + event.MetaHash + " chunks=" +
+		strings.Join(chunks, ",")
+}
+
+/*
+	SearchFinished is published when a search found enough files having all their chunks available
+ */
+type SearchFinished struct {
+	Keywords		[]string
+}
+
+func (event SearchFinished) Text() string {
+	return "SEARCH FINISHED"
+}
+
+/*
+	BlockFound is published when we mine a block
+ */
+type BlockFound struct {
+	Hash			string
+}
+
+func (event BlockFound) Text() string {
+	return "FOUND-BLOCK " + event.Hash
+}
+
+/*
+	A BlockSummary describes a block of a chain : its hash, the hash of its parent and the names it binds
+ */
+type BlockSummary struct {
+	Hash			string
+	PrevHash		string
+	Names			[]string
+}
+
+/*
+	ChainUpdated is published when the main chain changes, with its blocks from the head to the first one
+ */
+type ChainUpdated struct {
+	Blocks			[]BlockSummary
+}
+
+func (event ChainUpdated) Text() string {
+	str := "CHAIN"
+	for _, block := range event.Blocks {
+		str += " [" + block.Hash + ":" + block.PrevHash + ":" + strings.Join(block.Names, ",") + "]"
+	}
+	return str
+}
+
+/*
+	ForkDetected is published when we receive a block that is not on top of the main chain. If the branch of the
+	block has more work, Longer is true and we rewound Rewound blocks to switch to it
+ */
+type ForkDetected struct {
+	Hash			string
+	Longer			bool
+	Rewound			int
+}
+
+func (event ForkDetected) Text() string {
+	if event.Longer {
+		return "FORK-LONGER rewind " + fmt.Sprint(event.Rewound) + " blocks"
+	}
+	return "FORK-SHORTER " + event.Hash
+}
@@ -3,14 +3,11 @@ package gossiper
 import (
 	"crypto/sha256"
 	"encoding/hex"
-	"fmt"
 	"github.com/Theyiot/Peerster/constants"
 	"github.com/Theyiot/Peerster/util"
-	"math/rand"
-	"net"
 	"os"
 	"sort"
-	"strconv"
+	"time"
 )
 
 /*
@@ -26,13 +23,9 @@ func (gossiper *Gossiper) indexFile(fileName string) {
 	fileStat, err := file.Stat()
 	if util.CheckAndPrintError(err) {
 		return
-	} else if fileStat.Size() > constants.CHUNK_SIZE * sha256.Size {
-		println("Cannot index file " + fileName + " because it is too big : " + fmt.Sprint(fileStat.Size()) +
-			" instead of at most " + fmt.Sprint(constants.CHUNK_SIZE * sha256.Size))
-		return
 	}
 	totalByte := int64(0)
-	metaFile := make([]byte, 0)
+	hashes := make([][]byte, 0)
 	for totalByte < fileStat.Size() {
 		chunk := make([]byte, constants.CHUNK_SIZE)
 		n, err := file.Read(chunk)
@@ -41,29 +34,37 @@ func (gossiper *Gossiper) indexFile(fileName string) {
 		}
 		hash := sha256.Sum256(chunk[:n])
 		hashString := hex.EncodeToString(hash[:])
-		metaFile = append(metaFile, hash[:]...)
+		hashes = append(hashes, hash[:])
 		err = writeChunk(hashString, chunk[:n])
 		if util.CheckAndPrintError(err) {
 			return
 		}
 		totalByte += int64(n)
 	}
+	metaFile, err := buildMetaFile(hashes)
+	if util.CheckAndPrintError(err) {
+		return
+	}
 	metaHash := sha256.Sum256(metaFile)
 	metaHashHex := hex.EncodeToString(metaHash[:])
+	if util.CheckAndPrintError(writeChunk(metaHashHex, metaFile)) {
+		return
+	}
 	indexedFile := IndexedFile{FileName: fileName, FileSize: fileStat.Size(), MetaFile: metaFile}
-	gossiper.IndexedFiles.Store(metaHashHex, indexedFile)
+	gossiper.storeIndexedFile(metaHashHex, indexedFile)
 
-	fileTransaction := File{ Name: fileName, Size:totalByte, MetafileHash:metaFile }
+	//THE NAME IS ONLY PUBLISHED IF IT IS NOT ALREADY BOUND OR WAITING TO BE, BUT THE FILE IS SERVED ANYWAY
+	fileTransaction := File{ Name: fileName, Size:totalByte, MetafileHash:metaHash[:] }
 	transaction := TxPublish{ HopLimit:constants.HOP_LIMIT_SMALL, File: fileTransaction}
 	_, exist := gossiper.NameToMetaHash.Load(transaction.File.Name)
 	if exist {
 		return
 	}
-	gossiper.Transactions.Add(&transaction)
+	if !gossiper.Transactions.Add(&transaction) {
+		return
+	}
+	gossiper.refreshMining()
 	gossiper.broadcastGossipPacket(GossipPacket{ TxPublish: &transaction }, gossiper.Peers.GetAddresses())
-
-	util.CheckAndPrintError(writeChunk(metaHashHex, metaFile))
-	return
 }
 
 /*
@@ -76,8 +77,8 @@ func (gossiper *Gossiper) requestFile(fileName string, metaHashHex string) {
 		println("ERROR : Requesting an unknown file from multiple peers")
 		return
 	}
-	searchedFileChunks := searchedFile.([]SearchedFileChunk)
-	if len(searchedFileChunks) < 1 || searchedFileChunks[0].ChunkCount != uint64(len(searchedFileChunks)) {
+	searchedFileChunks := searchedFile.([]*SearchedFileChunk)
+	if !gossiper.knowsAllChunkOwners(metaHashHex) {
 		println("ERROR : Trying to request for which we don't know where to find all the chunks")
 		return
 	}
@@ -85,31 +86,82 @@ func (gossiper *Gossiper) requestFile(fileName string, metaHashHex string) {
 		return searchedFileChunks[i].ChunkID < searchedFileChunks[j].ChunkID
 	})
 
-	destination := searchedFileChunks[0].owningPeers[0]
-	metaFile, success := gossiper.requestMetaFile(fileName, destination, metaHashHex)
+	owningPeers := make([]string, 0)
+	for _, searchedFileChunk := range searchedFileChunks {
+		owningPeers = append(owningPeers, searchedFileChunk.getOwners()...)
+	}
+	journal, success := gossiper.beginDownload(fileName, metaHashHex, owningPeers)
+	if !success {
+		return
+	}
+	defer gossiper.endDownload(journal)
+
+	destination := searchedFileChunks[0].getOwners()[0]
+	metaFile, success := gossiper.fetchMetaFile(fileName, destination, metaHashHex)
 	if !success || !checkAndPrintSameHash(metaHashHex, metaFile){
 		return
 	}
 
-	hashesCopy := gossiper.getHashesAsList(metaFile)
-	indexedFile := IndexedFile{MetaFile: metaFile, FileName: fileName}
+	hashesCopy, success := gossiper.resolveRemoteMetaFile(fileName, destination, metaFile)
+	if !success {
+		return
+	} else if uint64(len(hashesCopy)) != searchedFileChunks[0].ChunkCount {
+		println("ERROR : The metafile of " + fileName + " does not describe the number of chunks that were found")
+		return
+	}
 
-	file, err := os.Create(constants.PATH_DOWNOADS + fileName)
-	if util.CheckAndPrintError(err) {
+	gossiper.reconstructFile(journal, metaFile, hashesCopy, func(i int) []string {
+		return searchedFileChunks[i].getOwners()
+	})
+}
+
+/*
+	requestFileByName allows the user to download a file only from its name. The name is resolved into a metaHash
+	through the names bound on the main chain, the owners of the chunks are found with a search request and the
+	file is then downloaded from all of them
+ */
+func (gossiper *Gossiper) requestFileByName(fileName string) {
+	metaHash, exist := gossiper.NameToMetaHash.Load(fileName)
+	if !exist {
+		println("ERROR : The name " + fileName + " is not bound on the main chain")
 		return
 	}
-	defer file.Close()
+	metaHashHex := hex.EncodeToString(metaHash.([]byte))
+	gossiper.publish(NameResolved{ FileName: fileName, MetaHash: metaHashHex })
+
+	if !gossiper.searchChunkOwners(fileName, metaHashHex) {
+		println("ERROR : Could not find peers owning all the chunks of " + fileName)
+		return
+	}
+	gossiper.requestFile(fileName, metaHashHex)
+}
 
-	fileSize := 0
-	for i, request := range hashesCopy {
-		destination = searchedFileChunks[i].owningPeers[rand.Intn(len(searchedFileChunks[i].owningPeers))]
-		n := gossiper.requestFileChunk(fileName, destination, request, i, file)
-		fileSize += n
+/*
+	searchChunkOwners sends search requests for the given name, with a budget that doubles every second, until we
+	know owners for all the chunks of the file with the given metaHash or the maximum budget is reached
+ */
+func (gossiper *Gossiper) searchChunkOwners(fileName, metaHashHex string) bool {
+	for budget := uint64(constants.DEFAULT_BUDGET) ; budget <= constants.MAX_BUDGET ; budget *= 2 {
+		if gossiper.knowsAllChunkOwners(metaHashHex) {
+			return true
+		}
+		gossiper.sendSearchPacket(budget, gossiper.Name, []string{fileName}, gossiper.Peers.GetAddresses())
+		gossiper.Clock.Sleep(time.Second)
 	}
-	gossiper.ToPrint <- "RECONSTRUCTED file " + fileName
+	return gossiper.knowsAllChunkOwners(metaHashHex)
+}
 
-	indexedFile.FileSize = int64(fileSize)
-	gossiper.IndexedFiles.Store(metaHashHex, indexedFile)
+/*
+	knowsAllChunkOwners checks whether search replies told us at least one owner for every chunk of the file with
+	the given metaHash
+ */
+func (gossiper *Gossiper) knowsAllChunkOwners(metaHashHex string) bool {
+	searchedFile, found := gossiper.SearchedFiles.Load(metaHashHex)
+	if !found {
+		return false
+	}
+	searchedFileChunks := searchedFile.([]*SearchedFileChunk)
+	return len(searchedFileChunks) > 0 && searchedFileChunks[0].ChunkCount == uint64(len(searchedFileChunks))
 }
 
 /*
@@ -117,82 +169,171 @@ func (gossiper *Gossiper) requestFile(fileName string, metaHashHex string) {
 	the user is sure that the peer from who it requests that file has the entirety of it
  */
 func (gossiper *Gossiper) requestFileFrom(fileName string, destination string, hashHex string) {
-	metaFile, success := gossiper.requestMetaFile(fileName, destination, hashHex)
+	journal, success := gossiper.beginDownload(fileName, hashHex, []string{destination})
 	if !success {
 		return
 	}
+	defer gossiper.endDownload(journal)
 
-	var indexedFile IndexedFile
-	hashesCopy := gossiper.getHashesAsList(metaFile)
+	metaFile, success := gossiper.fetchMetaFile(fileName, destination, hashHex)
+	if !success {
+		return
+	}
 
-	file, err := os.Create(constants.PATH_DOWNOADS + fileName)
-	if util.CheckAndPrintError(err) {
+	hashesCopy, success := gossiper.resolveRemoteMetaFile(fileName, destination, metaFile)
+	if !success {
 		return
 	}
-	defer file.Close()
 
-	fileSize := 0
-	for i, request := range hashesCopy {
-		n := gossiper.requestFileChunk(fileName, destination, request, i, file)
-		fileSize += n
+	gossiper.reconstructFile(journal, metaFile, hashesCopy, func(i int) []string {
+		return []string{destination}
+	})
+}
+
+/*
+	resumeDownloads restarts the downloads that were interrupted by a previous shutdown of the gossiper. Each
+	download waits until we know a route to one of the peers it was downloading from
+ */
+func (gossiper *Gossiper) resumeDownloads() {
+	for _, metaHashHex := range listDownloadJournals() {
+		journal, err := loadDownloadJournal(metaHashHex)
+		if util.CheckAndPrintError(err) {
+			continue
+		}
+		fileName, metaHashHex, destinations := journal.FileName, metaHashHex, journal.GetDestinations()
+		gossiper.spawn(func() { gossiper.resumeDownload(fileName, metaHashHex, destinations) })
 	}
-	gossiper.ToPrint <- "RECONSTRUCTED file " + fileName
+}
 
-	indexedFile.FileSize = int64(fileSize)
-	gossiper.IndexedFiles.Store(hashHex, indexedFile)
+/*
+	resumeDownload waits until a route to one of the given destinations is known, and then resumes the download
+	of the file from the known destinations
+ */
+func (gossiper *Gossiper) resumeDownload(fileName, metaHashHex string, destinations []string) {
+	ticker := gossiper.Clock.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		reachable := make([]string, 0)
+		for _, destination := range destinations {
+			if _, exist := gossiper.DSDV.GetNextHop(destination); exist {
+				reachable = append(reachable, destination)
+			}
+		}
+		if len(reachable) > 0 {
+			gossiper.resumeDownloadFrom(fileName, metaHashHex, reachable)
+			return
+		}
+		if !gossiper.wait(ticker.C) {
+			return
+		}
+	}
 }
 
 /*
-	requestFileChunk allows the user to download and store a chunk of a file from a given peer
+	resumeDownloadFrom resumes the download of a file by spreading the requests for the missing chunks among the
+	given peers
  */
-func (gossiper *Gossiper) requestFileChunk(fileName string, destination string, request []byte, i int, file *os.File) int {
-	str := "DOWNLOADING " + fileName + " chunk " + strconv.Itoa(i + 1) + " from " + destination
-	gossiper.ToPrint <- str
+func (gossiper *Gossiper) resumeDownloadFrom(fileName, metaHashHex string, destinations []string) {
+	journal, success := gossiper.beginDownload(fileName, metaHashHex, destinations)
+	if !success {
+		return
+	}
+	defer gossiper.endDownload(journal)
 
-	hashHex := hex.EncodeToString(request)
-	fileChannel := make(chan[]byte)
-	addr, exist := gossiper.DSDV.Load(destination)
-	if !exist {
-		return 0
+	metaFile, success := gossiper.fetchMetaFile(fileName, destinations[0], metaHashHex)
+	if !success {
+		return
 	}
 
-	gossiper.ReceivingFile.Store(hashHex, fileChannel)
-	defer gossiper.ReceivingFile.Delete(hex.EncodeToString(request))
+	hashesCopy, success := gossiper.resolveRemoteMetaFile(fileName, destinations[0], metaFile)
+	if !success {
+		return
+	}
 
-	chunk, err := gossiper.sendDataRequest(request, destination, addr.(*net.UDPAddr), fileChannel)
-	if util.CheckAndPrintError(err) || !checkAndPrintSameHash(hex.EncodeToString(request), chunk) {
-		return 0
+	gossiper.reconstructFile(journal, metaFile, hashesCopy, func(i int) []string {
+		return destinations
+	})
+}
+
+/*
+	beginDownload opens the journal of the download of the given file and makes sure that no other download of the
+	same file is running. It returns false if the download can not start
+ */
+func (gossiper *Gossiper) beginDownload(fileName, metaHashHex string, destinations []string) (*DownloadJournal, bool) {
+	if !IsHexHash(metaHashHex) {
+		println("ERROR : trying to download a file from something that is not a hash : " + metaHashHex)
+		return nil, false
+	}
+	if _, exist := gossiper.Downloads.LoadOrStore(metaHashHex, Signal{}); exist {
+		println("ERROR : file with metaHash " + metaHashHex + " is already being downloaded")
+		return nil, false
+	}
+	journal, err := openDownloadJournal(fileName, metaHashHex, destinations)
+	if util.CheckAndPrintError(err) {
+		gossiper.Downloads.Delete(metaHashHex)
+		return nil, false
+	}
+	return journal, true
+}
+
+/*
+	endDownload closes the journal of a download, which stays on the disk if the download did not complete, and
+	allows the file to be downloaded again
+ */
+func (gossiper *Gossiper) endDownload(journal *DownloadJournal) {
+	journal.Close()
+	gossiper.Downloads.Delete(journal.MetaHashHex)
+}
+
+/*
+	reconstructFile writes the file described by the given hashes in the "_Downloads" folder. The chunks that the
+	journal marks as verified are read from the "._FileChunks" folder, the other ones are downloaded in parallel
+	from the peers returned by owners. If a chunk can not be obtained, the download stops and can be resumed later
+ */
+func (gossiper *Gossiper) reconstructFile(journal *DownloadJournal, metaFile []byte, hashes [][]byte,
+	owners func(i int) []string) {
+	fileName := journal.FileName
+	file, err := os.Create(constants.PATH_DOWNOADS + fileName)
+	if util.CheckAndPrintError(err) {
+		return
 	}
-	n, err := file.Write(chunk)
-	if n != len(chunk) {
-		println("ERROR : The method write did not write the entire buffer")
-		return 0
+	defer file.Close()
+
+	if journal.VerifiedCount() > 0 {
+		firstMissing := 0
+		for firstMissing < len(hashes) && journal.IsVerified(uint64(firstMissing)) {
+			firstMissing++
+		}
+		gossiper.publish(DownloadResumed{ FileName: fileName, FirstMissing: firstMissing + 1 })
 	}
+
+	fileSize, err := newDownloadScheduler(gossiper, journal, file, owners).run(hashes)
 	if util.CheckAndPrintError(err) {
-		os.Remove(constants.PATH_SHARED_FILES + fileName)
-		return 0
+		println("ERROR : download of " + fileName + " interrupted, request it again to resume")
+		return
 	}
-	return n
+	gossiper.publish(FileReconstructed{ FileName: fileName })
+
+	journal.Remove()
+	indexedFile := IndexedFile{MetaFile: metaFile, FileName: fileName, FileSize: fileSize}
+	gossiper.storeIndexedFile(journal.MetaHashHex, indexedFile)
 }
 
 /*
 	requestMetaFile allows the user to download and store a metaFile from a given peer
  */
 func (gossiper *Gossiper) requestMetaFile(fileName, destination, hashHex string) ([]byte, bool) {
-	addrNotCasted, exist := gossiper.DSDV.Load(destination)
+	addr, exist := gossiper.DSDV.GetNextHop(destination)
 	if !exist {
 		println("trying to request metafile from an unknown peer for peer name : " + destination)
 		return nil, false
 	}
-	addr := addrNotCasted.(*net.UDPAddr)
 
-	fileChannel := make(chan[]byte)
-	defer close(fileChannel)
+	fileChannel := make(chan[]byte, 1)
 	gossiper.ReceivingFile.Store(hashHex, fileChannel)
 	defer gossiper.ReceivingFile.Delete(hashHex)
 
-	str := "DOWNLOADING metafile of " + fileName + " from " + destination
-	gossiper.ToPrint <- str
+	gossiper.publish(MetaFileRequested{ FileName: fileName, From: destination })
 
 	metaFile, err := gossiper.sendDataRequest(stringToHash(hashHex), destination, addr, fileChannel)
 	if util.CheckAndPrintError(err) || !checkAndPrintSameHash(hashHex, metaFile) {
@@ -201,11 +342,34 @@ func (gossiper *Gossiper) requestMetaFile(fileName, destination, hashHex string)
 	return metaFile, true
 }
 
+/*
+	fetchMetaFile returns the metafile with the given hash, reading it from the "._FileChunks" folder if we already
+	own it and downloading it from the given peer otherwise
+ */
+func (gossiper *Gossiper) fetchMetaFile(fileName, destination, hashHex string) ([]byte, bool) {
+	if _, err := os.Stat(constants.PATH_FILE_CHUNKS + hashHex); !os.IsNotExist(err) {
+		if metaFile, success := readVerifiedChunk(hashHex); success {
+			return metaFile, true
+		}
+	}
+	return gossiper.requestMetaFile(fileName, destination, hashHex)
+}
+
+/*
+	resolveRemoteMetaFile returns the hashes of all the chunks described by the given metafile. If the metafile is
+	the root of a metafile tree, the sub-metafiles we don't already own are downloaded from the given peer
+ */
+func (gossiper *Gossiper) resolveRemoteMetaFile(fileName, destination string, metaFile []byte) ([][]byte, bool) {
+	return resolveMetaFile(metaFile, func(hashHex string) ([]byte, bool) {
+		return gossiper.fetchMetaFile(fileName, destination, hashHex)
+	})
+}
+
 /*
 	getHashesAsList takes as input a metaFile, which it converts to a list of hash, which is more convenient
 	for the downloading process
  */
-func (gossiper *Gossiper) getHashesAsList(metaFile []byte) [][]byte {
+func getHashesAsList(metaFile []byte) [][]byte {
 	hashes := make([][]byte, 0)
 
 	for i := 0 ; i < len(metaFile) / sha256.Size ; i++ {
@@ -276,8 +440,14 @@ func readChunk(hashHex string) ([]byte, error) {
 	return buffer[:byteRead], nil
 }
 
-
-
-
-
-
+/*
+	readVerifiedChunk reads the chunk corresponding to the given hash from the "._FileChunks" folder, and makes sure
+	that its content actually corresponds to that hash
+ */
+func readVerifiedChunk(hashHex string) ([]byte, bool) {
+	chunk, err := readChunk(hashHex)
+	if util.CheckAndPrintError(err) || !checkAndPrintSameHash(hashHex, chunk) {
+		return nil, false
+	}
+	return chunk, true
+}
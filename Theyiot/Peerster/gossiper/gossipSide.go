@@ -1,9 +1,11 @@
 package gossiper
 
 import (
+	"errors"
 	"github.com/Theyiot/Peerster/constants"
 	"github.com/Theyiot/Peerster/util"
 	"github.com/dedis/protobuf"
+	"net"
 )
 
 
@@ -12,31 +14,32 @@ import (
 	packets, depending on their type
  */
 func (gossiper *Gossiper) handleGossip() {
-	// DataReplyPacket, Data : 8192, Hash : 32, Hop-Limit : 32, Origin : 512, dest : 512
-	biggestPacketSize := constants.CHUNK_SIZE + 1088
-	buf := make([]byte, biggestPacketSize)
+	// DataReplyPacket, Data : 8192, Hash : 32, Hop-Limit : 32, Origin : 512, dest : 512, Key : 32, Signature : 64
+	// BIGGER PACKETS ARE SPLIT INTO FRAGMENTS THAT FIT IN THIS BUFFER
+	buf := make([]byte, constants.MAX_DATAGRAM_SIZE)
 
 	for {
-		n, addr, err := gossiper.GossipServer.ReadFromUDP(buf)
-		if util.CheckAndPrintError(err) {
+		n, addr, err := gossiper.GossipServer.Receive(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		} else if util.CheckAndPrintError(err) {
 			continue
 		}
 		senderAddr := addr.String()
-		//Peers will only be added in case it is not already in the set of peers
-		gossiper.Peers.Add(senderAddr)
-
-		gossipPacket := GossipPacket{}
-		err = protobuf.Decode(buf[:n], &gossipPacket)
-		if util.CheckAndPrintError(err) {
-			continue
+		//Peers will only be added in case it is not already in the set of peers, and if the set is not full
+		gossiper.Peers.AddBounded(senderAddr, constants.MAX_PEERS)
+		if gossiper.Peers.MarkReceived(senderAddr) {
+			gossiper.publish(PeerStateChanged{ Address: senderAddr, State: constants.PEER_ALIVE })
 		}
 
-		if !checkExactlyOnePacketType(gossipPacket) {
-			println("GOSSIP SIDE : More than one field of the packet was not <nil>, dropping this packet")
+		// THE DECODED PACKET SHARES ITS BYTES WITH THE DATAGRAM, WHICH MUST THUS OUTLIVE THE BUFFER
+		datagram := append([]byte{}, buf[:n]...)
+		gossipPacket, complete := gossiper.decodeGossipPacket(datagram, senderAddr)
+		if !complete {
 			continue
 		}
 
-		go func() {
+		gossiper.spawn(func() {
 			if gossipPacket.Simple != nil { //SIMPLE PACKET
 				gossiper.receiveSimplePacket(gossipPacket)
 			} else if gossipPacket.Rumor != nil { //RUMOR PACKET
@@ -44,7 +47,13 @@ func (gossiper *Gossiper) handleGossip() {
 			} else if gossipPacket.Status != nil { //STATUS PACKET
 				gossiper.receiveStatusPacket(gossipPacket, addr)
 			} else if gossipPacket.Private != nil { //PRIVATE PAQUET
-				gossiper.receivePrivatePacket(gossipPacket, senderAddr)
+				gossiper.receivePrivatePacket(gossipPacket, addr)
+			} else if gossipPacket.PrivateAck != nil { //PRIVATE ACK PACKET
+				gossiper.receivePrivateAck(gossipPacket, addr)
+			} else if gossipPacket.MailboxDeposit != nil { //MAILBOX DEPOSIT PACKET
+				gossiper.receiveMailboxDeposit(gossipPacket, addr)
+			} else if gossipPacket.PeerExchange != nil { //PEER EXCHANGE PACKET
+				gossiper.receivePeerExchange(gossipPacket, addr)
 			} else if gossipPacket.DataRequest != nil { //DATA REQUEST PACKET
 				gossiper.receiveDataRequestPacket(gossipPacket, addr)
 			} else if gossipPacket.DataReply != nil { //DATA REPLY PACKET
@@ -57,11 +66,45 @@ func (gossiper *Gossiper) handleGossip() {
 				gossiper.receiveTxPublish(gossipPacket, addr)
 			} else if gossipPacket.BlockPublish != nil {
 				gossiper.receiveBlockPublish(gossipPacket, addr)
+			} else if gossipPacket.BlockRequest != nil {
+				gossiper.receiveBlockRequest(gossipPacket, addr)
+			} else if gossipPacket.BlockReply != nil {
+				gossiper.receiveBlockReply(gossipPacket, addr)
 			} else {
 				println("Received packet type that should not be sent to other peer")
 			}
-		}()
+		})
+	}
+}
+
+/*
+	decodeGossipPacket decodes a datagram received from the given address. When the datagram is a fragment, it
+	returns whether it was the last missing fragment of its packet, and the reassembled packet if so
+ */
+func (gossiper *Gossiper) decodeGossipPacket(datagram []byte, senderAddr string) (GossipPacket, bool) {
+	gossipPacket := GossipPacket{}
+	err := protobuf.Decode(datagram, &gossipPacket)
+	if util.CheckAndPrintError(err) {
+		return GossipPacket{}, false
+	} else if !checkExactlyOnePacketType(gossipPacket) {
+		println("GOSSIP SIDE : More than one field of the packet was not <nil>, dropping this packet")
+		return GossipPacket{}, false
+	} else if gossipPacket.Fragment == nil {
+		return gossipPacket, true
+	}
+
+	fragment := gossipPacket.Fragment
+	whole, err := gossiper.Reassembler.Add(senderAddr, fragment.ID, fragment.Index, fragment.Count, fragment.Data)
+	if util.CheckAndPrintError(err) || whole == nil {
+		return GossipPacket{}, false
+	}
+	gossipPacket = GossipPacket{}
+	err = protobuf.Decode(whole, &gossipPacket)
+	if util.CheckAndPrintError(err) || !checkExactlyOnePacketType(gossipPacket) || gossipPacket.Fragment != nil {
+		println("GOSSIP SIDE : the reassembled packet from " + senderAddr + " is not valid, dropping this packet")
+		return GossipPacket{}, false
 	}
+	return gossipPacket, true
 }
 
 /*
@@ -73,12 +116,18 @@ func checkExactlyOnePacketType(gossipPacket GossipPacket) bool {
 	if gossipPacket.Rumor != nil { count++ }
 	if gossipPacket.Status != nil { count++ }
 	if gossipPacket.Private != nil { count++ }
+	if gossipPacket.PrivateAck != nil { count++ }
+	if gossipPacket.MailboxDeposit != nil { count++ }
+	if gossipPacket.PeerExchange != nil { count++ }
 	if gossipPacket.DataRequest != nil { count++ }
 	if gossipPacket.DataReply != nil { count++ }
 	if gossipPacket.SearchRequest != nil { count++ }
 	if gossipPacket.SearchReply != nil { count++ }
 	if gossipPacket.TxPublish != nil { count++ }
 	if gossipPacket.BlockPublish != nil { count++ }
+	if gossipPacket.BlockRequest != nil { count++ }
+	if gossipPacket.BlockReply != nil { count++ }
+	if gossipPacket.Fragment != nil { count++ }
 	if count == 0 {
 		println("Found 0 matching type of packet")
 	}
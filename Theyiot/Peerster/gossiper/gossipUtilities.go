@@ -3,33 +3,46 @@ package gossiper
 import (
 	"encoding/hex"
 	"fmt"
+	"github.com/Theyiot/Peerster/constants"
 	"github.com/Theyiot/Peerster/util"
-	"github.com/dedis/protobuf"
-	"strings"
-	"sync"
 	"time"
 )
 
 /*
-	printMessages continuously waits for message to print in the terminal
+	printEvents is the subscriber printing the text of the events to the output of the gossiper, until it is stopped
  */
-func (gossiper *Gossiper) printMessages() {
-	for str := range gossiper.ToPrint {
-		fmt.Println(str)
+func (gossiper *Gossiper) printEvents(events <-chan Event, unsubscribe func()) {
+	defer unsubscribe()
+	for {
+		select {
+		case event := <- events:
+			if str := event.Text(); str != "" {
+				fmt.Fprintln(gossiper.Config.Output, str)
+			}
+		case <- gossiper.ctx.Done():
+			return
+		}
 	}
 }
 
 /*
-	sendPacket continuously waits for packets to send to other peers
+	publish delivers the event to the subscribers of gossiper.Events, without waiting for the ones that are lagging
+	behind
  */
-func (gossiper *Gossiper) sendPacket() {
-	for packet := range gossiper.ToSend {
-		bytes, err := protobuf.Encode(packet.GossipPacket)
-		if util.CheckAndPrintError(err) {
-			continue
-		}
-		gossiper.GossipServer.WriteToUDP(bytes, packet.Address)
+func (gossiper *Gossiper) publish(event Event) {
+	gossiper.Events.publish(event)
+}
+
+/*
+	peerList returns the addresses of the peers that are not dead, as they are given in events
+ */
+func (gossiper *Gossiper) peerList() []string {
+	addresses := gossiper.Peers.GetAddresses()
+	peers := make([]string, len(addresses))
+	for i, address := range addresses {
+		peers[i] = address.String()
 	}
+	return peers
 }
 
 /*
@@ -37,16 +50,29 @@ func (gossiper *Gossiper) sendPacket() {
 	network is up-to-date
  */
 func (gossiper *Gossiper) antiEntropy() {
-	for {
-		ticker := time.NewTicker(time.Second)
+	ticker := gossiper.Clock.NewTicker(time.Second)
+	defer ticker.Stop()
+	for gossiper.wait(ticker.C) {
+		if !gossiper.Peers.IsEmpty() {
+			randomPeer := gossiper.Peers.ChooseRandomPeer()
+			gossiper.send(PacketToSend{ Address: randomPeer, GossipPacket: &GossipPacket{ Status: gossiper.constructStatuses() }})
+		}
+	}
+}
 
-		select {
-		case <- ticker.C:
-			if !gossiper.Peers.IsEmpty() {
-				randomPeer := gossiper.Peers.ChooseRandomPeer()
-				gossiper.ToSend <- PacketToSend{ Address: randomPeer, GossipPacket: &GossipPacket{ Status: gossiper.constructStatuses() }}
-				ticker.Stop()
-			}
+/*
+	probeDeadPeers periodically sends a peer exchange to a random dead peer, whose answer makes it alive again, so
+	that the network recovers once a partition is over. The peers that stay dead for too long are forgotten
+ */
+func (gossiper *Gossiper) probeDeadPeers() {
+	ticker := gossiper.Clock.NewTicker(constants.DEAD_PEER_PROBE_TIMER * time.Second)
+	defer ticker.Stop()
+	for gossiper.wait(ticker.C) {
+		for _, address := range gossiper.Peers.RemoveDeadPeers(constants.DEAD_PEER_EXPIRY * time.Second) {
+			gossiper.publish(PeerStateChanged{ Address: address, State: constants.PEER_REMOVED })
+		}
+		if deadPeer := gossiper.Peers.ChooseRandomDeadPeer(); deadPeer != nil {
+			gossiper.sendPeerExchange(deadPeer, false)
 		}
 	}
 }
@@ -58,13 +84,10 @@ func (gossiper *Gossiper) antiEntropy() {
  */
 func (gossiper *Gossiper) routeRumor(rtimer uint) {
 	gossiper.sendRouteRumor()
-	for {
-		ticker := time.NewTicker(time.Duration(rtimer) * time.Second)
-
-		select {
-		case <- ticker.C:
-			gossiper.sendRouteRumor()
-		}
+	ticker := gossiper.Clock.NewTicker(time.Duration(rtimer) * time.Second)
+	defer ticker.Stop()
+	for gossiper.wait(ticker.C) {
+		gossiper.sendRouteRumor()
 	}
 }
 
@@ -74,92 +97,237 @@ func (gossiper *Gossiper) routeRumor(rtimer uint) {
 func (gossiper *Gossiper) sendRouteRumor() {
 	if !gossiper.Peers.IsEmpty() { //WE DO NOTHING WHILE WE DON'T KNOW ONE PEER AT LEAST
 		id, _ := gossiper.VectorClock.LoadOrStore(gossiper.Name, uint32(1))
-		gossipPacket := GossipPacket{Rumor: &RumorMessage{Text: "", Origin: gossiper.Name, ID: id.(uint32)}}
+		rumorMessage := RumorMessage{Text: "", Origin: gossiper.Name, ID: id.(uint32),
+			OriginAddr: gossiper.advertisedAddress()}
+		gossiper.signRumor(&rumorMessage)
+		gossipPacket := GossipPacket{Rumor: &rumorMessage}
 
 		//WE STORE THE RUMOR PACKET
-		gossiper.Rumors.Store(fmt.Sprint(id.(uint32)) + "@" + gossiper.Name,
-			GossipPacketTimed{GossipPacket: gossipPacket, Timestamp: time.Now()})
+		gossiper.storeRumor(fmt.Sprint(id.(uint32)) + "@" + gossiper.Name,
+			GossipPacketTimed{GossipPacket: gossipPacket, Timestamp: gossiper.Clock.Now()})
 
 		//WE STORE THE RIGHT VECTOR CLOCK VALUE
-		gossiper.VectorClock.Store(gossiper.Name, id.(uint32) + uint32(1))
+		gossiper.storeNextID(gossiper.Name, id.(uint32) + uint32(1))
 
 		//SENDING THE ROUTE RUMOR
 		peerAddr := gossiper.Peers.ChooseRandomPeer()
-		gossiper.ToSend <- PacketToSend{GossipPacket: &gossipPacket, Address: peerAddr}
+		gossiper.send(PacketToSend{GossipPacket: &gossipPacket, Address: peerAddr})
 	}
 }
 
 /*
-	sendPacket continuously waits for packets to send to other peers
+	expireRoutes periodically removes the routes that were not confirmed by a packet of their destination during
+	the last gossiper.RouteExpiry seconds
+ */
+func (gossiper *Gossiper) expireRoutes() {
+	maxAge := time.Duration(gossiper.RouteExpiry) * time.Second
+	ticker := gossiper.Clock.NewTicker(maxAge / 10 + time.Second)
+	defer ticker.Stop()
+	for gossiper.wait(ticker.C) {
+		for _, origin := range gossiper.DSDV.Expire(maxAge) {
+			if gossiper.Storage != nil {
+				util.CheckAndPrintError(gossiper.Storage.Delete(constants.BUCKET_DSDV, origin))
+			}
+			gossiper.publish(RouteExpired{ Destination: origin })
+		}
+	}
+}
+
+/*
+	addBlockToBlockchain continuously waits for valid blocks to add to the blockchain. Once a block is added, the
+	orphan blocks that were waiting for it are added as well
  */
 func (gossiper *Gossiper) addBlockToBlockchain() {
-	for block := range gossiper.ToAddToBlockchain {
-		newHash := block.Hash()
-		newHashHex := hex.EncodeToString(newHash[:])
-		prevHashHex := hex.EncodeToString(block.PrevHash[:])
-		//CHECKING IF WE ARE ON LONGEST CHAIN
-		if prevHashHex == gossiper.CurrentBlock.GetCurrentHash() {
-			str := gossiper.printChain(block)
-			gossiper.ToPrint <- str
+	for {
+		select {
+		case block := <- gossiper.ToAddToBlockchain:
+			gossiper.addBlock(block)
+			gossiper.adoptOrphanBlocks(block)
+		case <- gossiper.ctx.Done():
+			return
 		}
-		gossiper.Blockchain.Store(newHashHex, block)
+	}
+}
+
+/*
+	submitBlock hands a valid block to addBlockToBlockchain, unless the gossiper is stopped
+ */
+func (gossiper *Gossiper) submitBlock(block Block) {
+	select {
+	case gossiper.ToAddToBlockchain <- block:
+	case <- gossiper.Done():
+	}
+}
+
+/*
+	wait waits for the next tick of a ticker. It returns false if the gossiper is stopped first
+ */
+func (gossiper *Gossiper) wait(tick <-chan time.Time) bool {
+	select {
+	case <- tick:
+		return true
+	case <- gossiper.Done():
+		return false
+	}
+}
 
-		if gossiper.CurrentBlock.GetCurrentHash() == prevHashHex {
-			gossiper.CurrentBlock.IncrementDepth()
-			gossiper.CurrentBlock.SetCurrentHash(newHashHex)
-			for _, transaction := range block.Transactions {
-				gossiper.NameToMetaHash.Store(transaction.File.Name, transaction.File.MetafileHash)
+/*
+	adoptOrphanBlocks adds to the blockchain, in order, all the buffered descendants of the given block
+ */
+func (gossiper *Gossiper) adoptOrphanBlocks(parent Block) {
+	parents := []Block{parent}
+	for len(parents) > 0 {
+		parentHash := parents[0].Hash()
+		parents = parents[1:]
+		for _, child := range gossiper.OrphanBlocks.TakeChildren(hex.EncodeToString(parentHash[:])) {
+			childHash := child.Hash()
+			if err := gossiper.validateBlock(child); err != nil {
+				println("ERROR : rejecting orphan block " + hex.EncodeToString(childHash[:]) + " : " + err.Error())
+				continue
 			}
-			gossiper.BlockMined <- Signal{}
-			gossiper.mineBlock(newHash)
+			gossiper.addBlock(child)
+			parents = append(parents, child)
+		}
+	}
+}
+
+/*
+	addBlock adds a valid block to the blockchain, and updates the head of the main chain if needed. A block that
+	is already in the blockchain is ignored
+ */
+func (gossiper *Gossiper) addBlock(block Block) {
+	newHash := block.Hash()
+	newHashHex := hex.EncodeToString(newHash[:])
+	if _, exist := gossiper.Blockchain.Load(newHashHex); exist {
+		return
+	}
+	prevHashHex := hex.EncodeToString(block.PrevHash[:])
+	//CHECKING IF WE ARE ON LONGEST CHAIN
+	if prevHashHex == gossiper.CurrentBlock.GetCurrentHash() {
+		gossiper.publish(ChainUpdated{ Blocks: gossiper.summarizeChain(block) })
+	}
+	gossiper.storeBlock(newHashHex, block)
+	newInfo, _ := gossiper.getBlockInfo(newHashHex)
+
+	if gossiper.CurrentBlock.GetCurrentHash() == prevHashHex {
+		gossiper.CurrentBlock.SetDepth(newInfo.Height)
+		gossiper.CurrentBlock.SetCurrentHash(newHashHex)
+		for _, transaction := range block.Transactions {
+			gossiper.NameToMetaHash.Store(transaction.File.Name, transaction.File.MetafileHash)
+		}
+		gossiper.Transactions.flushFromBlock(block)
+		gossiper.refreshMining()
+	} else {
+		//THE MAIN CHAIN IS THE ONE WITH THE MOST CUMULATIVE WORK
+		currentInfo, _ := gossiper.getBlockInfo(gossiper.CurrentBlock.GetCurrentHash())
+		if newInfo.Work.Cmp(currentInfo.Work) > 0 {
+			rewound := gossiper.switchBranch(newHashHex)
+			gossiper.publish(ForkDetected{ Hash: newHashHex, Longer: true, Rewound: rewound })
+			gossiper.publish(ChainUpdated{ Blocks: gossiper.summarizeChain(block) })
 		} else {
-			newDepth := gossiper.computeDepth(newHashHex)
-			if newDepth > gossiper.CurrentBlock.GetDepth() {
-				gossiper.ToPrint <- "FORK-LONGER rewind " + " blocks"
-				gossiper.switchBranch(prevHashHex)
-				gossiper.CurrentBlock.SetDepth(newDepth)
-			} else {
-				gossiper.ToPrint <- "FORK-SHORTER " + newHashHex
-			}
+			gossiper.publish(ForkDetected{ Hash: newHashHex })
 		}
 	}
+	gossiper.persistCurrentBlock()
 }
 
-func (gossiper *Gossiper) switchBranch(prevHashHex string) {
-	gossiper.NameToMetaHash = sync.Map{}
-	hashHex := prevHashHex
-	for {
-		block, exist := gossiper.Blockchain.Load(hashHex)
-		if !exist {
-			return
+/*
+	switchBranch makes the given block the head of the main chain, and returns the number of blocks of the previous
+	main chain that were rewound. The names claimed on the abandoned branch are released, the ones claimed on the
+	new branch are bound, and the transactions that were only on the abandoned branch go back to the pending
+	transactions if they are still valid
+ */
+func (gossiper *Gossiper) switchBranch(newHashHex string) int {
+	oldBranch, newBranch := gossiper.getBranchesFromCommonAncestor(gossiper.CurrentBlock.GetCurrentHash(), newHashHex)
+
+	for _, block := range oldBranch {
+		for _, transaction := range block.Transactions {
+			gossiper.NameToMetaHash.Delete(transaction.File.Name)
 		}
-		for _, transaction := range block.(Block).Transactions {
+	}
+	//THE BLOCKS OF THE NEW BRANCH ARE APPLIED FROM THE OLDEST ONE
+	for i := len(newBranch) - 1 ; i >= 0 ; i-- {
+		for _, transaction := range newBranch[i].Transactions {
 			gossiper.NameToMetaHash.Store(transaction.File.Name, transaction.File.MetafileHash)
 		}
-		gossiper.Transactions.flushFromBlock(block.(Block))
-		hashHex = hex.EncodeToString(block.(Block).PrevHash[:])
+		gossiper.Transactions.flushFromBlock(newBranch[i])
+	}
+	newInfo, _ := gossiper.getBlockInfo(newHashHex)
+	gossiper.CurrentBlock.SetCurrentHash(newHashHex)
+	gossiper.CurrentBlock.SetDepth(newInfo.Height)
+
+	for i := len(oldBranch) - 1 ; i >= 0 ; i-- {
+		for _, transaction := range oldBranch[i].Transactions {
+			transaction := transaction
+			if gossiper.validateTransaction(transaction) == nil {
+				gossiper.Transactions.Add(&transaction)
+			}
+		}
 	}
+	gossiper.refreshMining()
+	return len(oldBranch)
 }
 
-func (gossiper *Gossiper) printChain(block Block) string {
-	str := "CHAIN"
+/*
+	getBranchesFromCommonAncestor returns the blocks that lead from the common ancestor of the two given blocks to
+	each of them, without the ancestor itself. The blocks of each branch are ordered from the given block to the
+	oldest one
+ */
+func (gossiper *Gossiper) getBranchesFromCommonAncestor(oldHashHex, newHashHex string) ([]Block, []Block) {
+	oldBranch, newBranch := make([]Block, 0), make([]Block, 0)
+	oldInfo, _ := gossiper.getBlockInfo(oldHashHex)
+	newInfo, _ := gossiper.getBlockInfo(newHashHex)
+	oldHeight, newHeight := oldInfo.Height, newInfo.Height
+
+	for oldHashHex != newHashHex {
+		if oldHeight >= newHeight {
+			block, exist := gossiper.Blockchain.Load(oldHashHex)
+			if !exist {
+				break
+			}
+			oldBranch = append(oldBranch, block.(Block))
+			prevHash := block.(Block).PrevHash
+			oldHashHex = hex.EncodeToString(prevHash[:])
+			oldHeight--
+		} else {
+			block, exist := gossiper.Blockchain.Load(newHashHex)
+			if !exist {
+				break
+			}
+			newBranch = append(newBranch, block.(Block))
+			prevHash := block.(Block).PrevHash
+			newHashHex = hex.EncodeToString(prevHash[:])
+			newHeight--
+		}
+	}
+	return oldBranch, newBranch
+}
+
+/*
+	summarizeChain returns the summaries of the given block and of all its ancestors, from the block to the first one
+ */
+func (gossiper *Gossiper) summarizeChain(block Block) []BlockSummary {
+	summaries := make([]BlockSummary, 0)
 	for {
-		str += " " + printBlock(block)
+		summaries = append(summaries, summarizeBlock(block))
 		newBlock, exist := gossiper.Blockchain.Load(hex.EncodeToString(block.PrevHash[:]))
 		if !exist {
 			break
 		}
 		block = newBlock.(Block)
 	}
-	return str
+	return summaries
 }
 
-func printBlock(block Block) string {
-	transactions := make([]string, 0)
+/*
+	summarizeBlock returns the hash of the block, the hash of its parent and the names it binds
+ */
+func summarizeBlock(block Block) BlockSummary {
+	names := make([]string, 0)
 	for _, transaction := range block.Transactions {
-		transactions = append(transactions, transaction.File.Name)
+		names = append(names, transaction.File.Name)
 	}
-	hashHex := hex.EncodeToString(block.Hash()[:])
-	prevHashHex := hex.EncodeToString(block.PrevHash[:])
-	return "[" + hashHex + ":" + prevHashHex + ":" + strings.Join(transactions, ",")
+	hash := block.Hash()
+	return BlockSummary{ Hash: hex.EncodeToString(hash[:]), PrevHash: hex.EncodeToString(block.PrevHash[:]),
+		Names: names }
 }
@@ -1,92 +1,262 @@
 package gossiper
 
 import (
-	"flag"
+	"context"
+	"errors"
+	"fmt"
 	"github.com/Theyiot/Peerster/constants"
 	"github.com/Theyiot/Peerster/util"
-	"net"
+	"net/http"
+	"path/filepath"
 	"sync"
 )
 
 
 /*
-	StartGossip takes care of launching the different functionalities of our peerster and to parse the
-	parameters provided by the client
+	New creates a gossiper from the given configuration. It opens the transports that are not given, and loads the
+	storage and the identity kept in config.DataDir (by default constants.PATH_STATE + name). The gossiper does
+	nothing until Start is called
  */
-func StartGossip() {
-	//FLAGS DEFINITION
-	uiPort := flag.String("UIPort", constants.DEFAULT_PORT, "Port for the UI client")
-	gossipAddr := flag.String("gossipAddr", constants.DEFAULT_GOSSIP_ADDR, "ip:port for the receiver")
-	name := flag.String("name", constants.DEFAULT_NAME, "name of the gossiper")
-	peersToSplit := flag.String("peers", "", "comma-separated list of peers of the form ip:port")
-	simple := flag.Bool("simple", false, "run gossiper in simple broadcast mode")
-	rtimer := flag.Uint("rtimer", 0, "Time between each route rumor")
-	flag.Parse()
-
-	uiServerAddr, err := net.ResolveUDPAddr(constants.UDP_VERSION, constants.LOCALHOST + ":" + *uiPort)
-	util.FailOnError(err)
-	gossipServerAddr, err := net.ResolveUDPAddr(constants.UDP_VERSION, *gossipAddr)
-	util.FailOnError(err)
-
-	uiServer, err := net.ListenUDP(constants.UDP_VERSION, uiServerAddr)
-	util.FailOnError(err)
-	defer uiServer.Close()
-	gossipServer, err := net.ListenUDP(constants.UDP_VERSION, gossipServerAddr)
-	util.FailOnError(err)
-	defer gossipServer.Close()
+func New(config Config) (*Gossiper, error) {
+	if config.Difficulty < constants.MIN_DIFFICULTY || config.Difficulty > constants.MAX_DIFFICULTY {
+		return nil, errors.New("invalid difficulty " + fmt.Sprint(config.Difficulty) + ", it must be between " +
+			fmt.Sprint(constants.MIN_DIFFICULTY) + " and " + fmt.Sprint(constants.MAX_DIFFICULTY))
+	}
+	if config.SendQueueSize < 1 {
+		return nil, errors.New("invalid send queue size " + fmt.Sprint(config.SendQueueSize) + ", it must be at least 1")
+	}
+	if config.Clock == nil {
+		config.Clock = util.RealClock{}
+	}
+	if config.DataDir == "" {
+		config.DataDir = constants.PATH_STATE + config.Name
+	}
+	if config.UIServer == nil {
+		if !util.CheckValidPort(config.UIPort) {
+			return nil, errors.New("invalid UI port " + config.UIPort)
+		}
+		uiServer, err := util.CreateUDPTransport(constants.LOCALHOST + ":" + config.UIPort)
+		if err != nil {
+			return nil, err
+		}
+		config.UIServer = uiServer
+	}
+	if config.GossipServer == nil {
+		gossipServer, err := util.CreateUDPTransport(config.GossipAddr)
+		if err != nil {
+			config.UIServer.Close()
+			return nil, err
+		}
+		config.GossipServer = gossipServer
+	}
+
+	storage, err := util.OpenKeyValueLog(filepath.Join(config.DataDir, constants.STATE_FILE))
+	if err != nil {
+		config.UIServer.Close()
+		config.GossipServer.Close()
+		return nil, err
+	}
+	identity, err := loadOrCreateIdentity(filepath.Join(config.DataDir, constants.IDENTITY_FILE))
+	if err != nil {
+		config.UIServer.Close()
+		config.GossipServer.Close()
+		storage.Close()
+		return nil, err
+	}
 
 	gossiper := Gossiper{
-		UIServer:      		uiServer,
-		GossipAddr:    		*gossipAddr,
-		GossipServer:  		gossipServer,
-		Name:          		*name,
-		Simple:        		*simple,
+		Config:				config,
+		UIServer:      		config.UIServer,
+		GossipAddr:    		config.GossipServer.LocalAddr().String(),
+		GossipServer:  		config.GossipServer,
+		Name:          		config.Name,
+		Simple:				config.Simple,
+		DownloadWindow:		config.Window,
+		MailboxReplicas:	config.MailboxReplicas,
+		DirectRoutes:		config.DirectRoutes,
 		CurrentBlock:		util.CreateCurrentBlockHash(),
 		Transactions:		createTransactionsSet(),
-		Peers:         		util.CreateAddrSet(*peersToSplit),
+		OrphanBlocks:		createOrphanBlocksSet(),
+		Consensus:			createConsensusParams(uint32(config.Difficulty)),
+		Identity:			identity,
+		Peers:         		util.CreateAddrSet(config.Peers, config.Clock),
 		ActiveSearches:		util.CreateFullMatchesSet(),
 		NameToMetaHash:		sync.Map{},
+		PublicKeys:			sync.Map{},
+		EncryptionKeys:		sync.Map{},
 		VectorClock:   		sync.Map{},
 		Rumors:        		sync.Map{},
 		Privates:      		sync.Map{},
-		DSDV:          		sync.Map{},
+		DSDV:          		util.CreateRoutingTable(config.Clock),
+		RouteExpiry:		config.RouteExpiry,
 		ReceivingFile: 		sync.Map{},
 		IndexedFiles:  		sync.Map{},
 		SearchedFiles: 		sync.Map{},
+		Downloads:			sync.Map{},
 		SearchRequests:		sync.Map{},
 		Acks:          		sync.Map{},
 		Blockchain:			sync.Map{},
-		BlocksMined:		sync.Map{},
-		ToPrint:       		make(chan string),
-		ToSend:        		make(chan PacketToSend),
+		BlockRequests:		sync.Map{},
+		BlockInfos:			sync.Map{},
+		Events:				createEventBus(),
+		Clock:				config.Clock,
+		SendQueues:			createSendQueues(config.SendQueueSize, config.PeerRate, config.GlobalRate, config.Clock),
+		Reassembler:		util.CreateReassembler(config.Clock),
 		ToAddToBlockchain:	make(chan Block),
+		MiningRefresh:		make(chan Signal, 1),
+		Storage:			storage,
+		done:				make(chan struct{}),
+	}
+	gossiper.Peers.SetLivenessThresholds(config.SuspectAfter, config.DeadAfter)
+	return &gossiper, nil
+}
+
+/*
+	Start reloads the state of the previous run of the gossiper and starts its routines, which run until the
+	context is cancelled or Stop is called. Start returns immediately
+ */
+func (gossiper *Gossiper) Start(ctx context.Context) error {
+	gossiper.routinesLock.Lock()
+	if gossiper.ctx != nil {
+		gossiper.routinesLock.Unlock()
+		return errors.New("the gossiper " + gossiper.Name + " was already started")
+	}
+	gossiper.ctx, gossiper.cancel = context.WithCancel(ctx)
+	gossiper.routinesLock.Unlock()
+
+	//PRINTING THE EVENTS
+	if gossiper.Config.Output != nil {
+		events, unsubscribe := gossiper.Events.SubscribeLossless()
+		gossiper.spawn(func() { gossiper.printEvents(events, unsubscribe) })
+	}
+
+	//RELOADING THE STATE OF THE PREVIOUS RUN
+	gossiper.loadState()
+	gossiper.PublicKeys.Store(gossiper.Name, gossiper.Identity.PublicKey)
+	gossiper.EncryptionKeys.Store(gossiper.Name, gossiper.Identity.EncryptionKey)
+
+	//CLOSING THE TRANSPORTS AND THE WEB SERVER ONCE STOPPED
+	if gossiper.Config.WebServer {
+		gossiper.webServer = gossiper.createWebServer(gossiper.Config.UIPort)
 	}
+	gossiper.spawn(gossiper.closeOnStop)
 
 	//UI COMMUNICATION
-	go gossiper.handleClient()
+	gossiper.spawn(gossiper.handleClient)
 
 	//GOSSIP COMMUNICATION
-	go gossiper.handleGossip()
+	gossiper.spawn(gossiper.handleGossip)
+
+	//OPENING WEB SERVER
+	if gossiper.webServer != nil {
+		gossiper.spawn(func() {
+			if err := gossiper.webServer.ListenAndServe(); err != http.ErrServerClosed {
+				util.CheckAndPrintError(err)
+			}
+		})
+	}
 
 	//ROUTE RUMOR
-	if *rtimer > 0 {
-		go gossiper.routeRumor(*rtimer)
+	if gossiper.Config.Rtimer > 0 {
+		gossiper.spawn(func() { gossiper.routeRumor(gossiper.Config.Rtimer) })
+	}
+
+	//PEER EXCHANGE
+	if gossiper.Config.PeerExchangeTimer > 0 {
+		gossiper.spawn(func() { gossiper.peerExchange(gossiper.Config.PeerExchangeTimer) })
+	}
+
+	//PROBING AND FORGETTING THE DEAD PEERS
+	if gossiper.Config.DeadAfter > 0 {
+		gossiper.spawn(gossiper.probeDeadPeers)
 	}
 
 	//ANTI-ENTROPY
 	if !gossiper.Simple {
-		go gossiper.antiEntropy()
+		gossiper.spawn(gossiper.antiEntropy)
 	}
 
-	//SENDING PACKETS
-	go gossiper.sendPacket()
+	//RESUMING INTERRUPTED DOWNLOADS
+	gossiper.spawn(gossiper.resumeDownloads)
 
-	//OPENING WEB SERVER
-	go gossiper.StartWebServer(*uiPort)
+	//REMOVING THE STALE ROUTES
+	if gossiper.RouteExpiry > 0 {
+		gossiper.spawn(gossiper.expireRoutes)
+	}
+
+	//DELIVERING THE PRIVATE MESSAGES OF THE MAILBOX
+	gossiper.spawn(gossiper.flushMailboxes)
 
 	//ADDING BLOCK TO BLOCKCHAIN
-	go gossiper.addBlockToBlockchain()
+	gossiper.spawn(gossiper.addBlockToBlockchain)
+
+	//ASKING AGAIN FOR THE MISSING ANCESTORS OF THE ORPHAN BLOCKS
+	gossiper.spawn(gossiper.requestMissingAncestors)
+
+	//MINING BLOCKS WITH THE PENDING TRANSACTIONS
+	if gossiper.Config.Mining {
+		gossiper.spawn(gossiper.mine)
+	}
+	return nil
+}
+
+/*
+	Stop cancels the context of the gossiper, waits for all its routines to return, and closes its transports and
+	its storage. The gossiper can not be started again afterwards
+ */
+func (gossiper *Gossiper) Stop() error {
+	gossiper.routinesLock.Lock()
+	if gossiper.cancel != nil {
+		gossiper.cancel()
+	}
+	gossiper.routinesLock.Unlock()
+	gossiper.routines.Wait()
+
+	var err error
+	gossiper.doneOnce.Do(func() { close(gossiper.done) })
+	gossiper.stopOnce.Do(func() {
+		gossiper.UIServer.Close()
+		gossiper.GossipServer.Close()
+		err = gossiper.Storage.Close()
+	})
+	return err
+}
 
-	//PRINTING CONTENTS
-	gossiper.printMessages()
-}
\ No newline at end of file
+/*
+	Done returns a channel that is closed once the gossiper is stopped
+ */
+func (gossiper *Gossiper) Done() <-chan struct{} {
+	return gossiper.done
+}
+
+/*
+	spawn runs the routine in its own goroutine, which Stop waits for. Nothing is run once the gossiper is stopped
+ */
+func (gossiper *Gossiper) spawn(routine func()) {
+	gossiper.routinesLock.Lock()
+	if gossiper.ctx == nil || gossiper.ctx.Err() != nil {
+		gossiper.routinesLock.Unlock()
+		return
+	}
+	gossiper.routines.Add(1)
+	gossiper.routinesLock.Unlock()
+
+	go func() {
+		defer gossiper.routines.Done()
+		routine()
+	}()
+}
+
+/*
+	closeOnStop waits for the gossiper to be stopped and then closes Done, its transports and its web server, so
+	that the routines waiting for packets or requests return
+ */
+func (gossiper *Gossiper) closeOnStop() {
+	<- gossiper.ctx.Done()
+	gossiper.doneOnce.Do(func() { close(gossiper.done) })
+	gossiper.UIServer.Close()
+	gossiper.GossipServer.Close()
+	if gossiper.webServer != nil {
+		gossiper.webServer.Close()
+	}
+}
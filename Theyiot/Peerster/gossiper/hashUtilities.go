@@ -15,6 +15,8 @@ func (b *Block) Hash() (out [32]byte) {
 	h := sha256.New()
 	h.Write(b.PrevHash[:])
 	h.Write(b.Nonce[:])
+	binary.Write(h,binary.LittleEndian, b.Timestamp)
+	binary.Write(h,binary.LittleEndian, b.Difficulty)
 	binary.Write(h,binary.LittleEndian,
 		uint32(len(b.Transactions)))
 	for _, t := range b.Transactions {
@@ -0,0 +1,223 @@
+package gossiper
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"github.com/Theyiot/Peerster/constants"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/*
+	An Identity is the Ed25519 key pair of a gossiper. The public key is sent along with every signed packet, and
+	the other peers bind the name of the gossiper to the first public key they see for it. The X25519 key pair used
+	to receive encrypted private messages is derived from the same seed
+ */
+type Identity struct {
+	PublicKey				ed25519.PublicKey
+	EncryptionKey			[]byte
+	privateKey				ed25519.PrivateKey
+	encryptionPrivateKey	*ecdh.PrivateKey
+}
+
+/*
+	loadOrCreateIdentity reads the seed of the key pair stored at the given path, or generates a new key pair and
+	stores its seed there if the file does not exist yet
+ */
+func loadOrCreateIdentity(path string) (*Identity, error) {
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+			return nil, err
+		}
+		seed := hex.EncodeToString(privateKey.Seed())
+		if err := ioutil.WriteFile(path, []byte(seed + "\n"), 0600); err != nil {
+			return nil, err
+		}
+		return createIdentity(publicKey, privateKey)
+	} else if err != nil {
+		return nil, err
+	}
+
+	seed, err := hex.DecodeString(strings.TrimSpace(string(content)))
+	if err != nil {
+		return nil, err
+	} else if len(seed) != ed25519.SeedSize {
+		return nil, errors.New("the identity file " + path + " does not contain a valid seed")
+	}
+	privateKey := ed25519.NewKeyFromSeed(seed)
+	return createIdentity(privateKey.Public().(ed25519.PublicKey), privateKey)
+}
+
+/*
+	createIdentity returns the identity of the given Ed25519 key pair, along with its X25519 key pair
+ */
+func createIdentity(publicKey ed25519.PublicKey, privateKey ed25519.PrivateKey) (*Identity, error) {
+	encryptionSeed := sha256.Sum256(append([]byte(constants.ENCRYPTION_KEY_DOMAIN), privateKey.Seed()...))
+	encryptionPrivateKey, err := ecdh.X25519().NewPrivateKey(encryptionSeed[:])
+	if err != nil {
+		return nil, err
+	}
+	return &Identity{PublicKey: publicKey, EncryptionKey: encryptionPrivateKey.PublicKey().Bytes(),
+		privateKey: privateKey, encryptionPrivateKey: encryptionPrivateKey}, nil
+}
+
+/*
+	Sign returns the signature of the given content with the private key of the identity
+ */
+func (identity *Identity) Sign(content []byte) []byte {
+	return ed25519.Sign(identity.privateKey, content)
+}
+
+/*
+	verifyOrigin checks that the signature of a packet was made by the given origin. The signature must be valid for
+	the public key carried by the packet, and this key must be the one bound to the origin. An origin we never heard
+	of is bound to the key of its first valid packet
+ */
+func (gossiper *Gossiper) verifyOrigin(origin string, publicKey, content, signature []byte) error {
+	if len(publicKey) != ed25519.PublicKeySize {
+		return errors.New("the packet of " + origin + " does not carry a valid public key")
+	}
+	if len(signature) != ed25519.SignatureSize || !ed25519.Verify(publicKey, content, signature) {
+		return errors.New("the signature of the packet of " + origin + " is not valid")
+	}
+
+	keyCopy := make(ed25519.PublicKey, ed25519.PublicKeySize)
+	copy(keyCopy, publicKey)
+	knownKey, exist := gossiper.PublicKeys.LoadOrStore(origin, keyCopy)
+	if exist && !bytes.Equal(knownKey.(ed25519.PublicKey), publicKey) {
+		return errors.New("the name " + origin + " is bound to another public key")
+	} else if !exist {
+		gossiper.persist(constants.BUCKET_PUBLIC_KEYS, origin, hex.EncodeToString(publicKey))
+		gossiper.publish(IdentityLearned{ Origin: origin, PublicKey: keyCopy })
+	}
+	return nil
+}
+
+/*
+	signRumor signs a rumor created by this gossiper
+ */
+func (gossiper *Gossiper) signRumor(rumor *RumorMessage) {
+	rumor.PublicKey = gossiper.Identity.PublicKey
+	rumor.EncryptionKey = gossiper.Identity.EncryptionKey
+	rumor.Signature = gossiper.Identity.Sign(rumor.signedContent())
+}
+
+/*
+	signPrivate signs a private message created by this gossiper
+ */
+func (gossiper *Gossiper) signPrivate(private *PrivateMessage) {
+	private.PublicKey = gossiper.Identity.PublicKey
+	private.Signature = gossiper.Identity.Sign(private.signedContent())
+}
+
+/*
+	signPrivateAck signs an acknowledgement created by this gossiper
+ */
+func (gossiper *Gossiper) signPrivateAck(ack *PrivateAck) {
+	ack.PublicKey = gossiper.Identity.PublicKey
+	ack.Signature = gossiper.Identity.Sign(ack.signedContent())
+}
+
+/*
+	signSearchReply signs a search reply created by this gossiper
+ */
+func (gossiper *Gossiper) signSearchReply(searchReply *SearchReply) {
+	searchReply.PublicKey = gossiper.Identity.PublicKey
+	searchReply.Signature = gossiper.Identity.Sign(searchReply.signedContent())
+}
+
+/*
+	signDataReply signs a data reply created by this gossiper
+ */
+func (gossiper *Gossiper) signDataReply(dataReply *DataReply) {
+	dataReply.PublicKey = gossiper.Identity.PublicKey
+	dataReply.Signature = gossiper.Identity.Sign(dataReply.signedContent())
+}
+
+/*
+	signedContent returns the bytes covered by the signature of a rumor, which also announces the key used to send
+	encrypted private messages to its origin. The hop count is not signed, since it is increased by every peer that
+	relays the rumor. A relay can thus lie about it to attract the routes towards the origin : rumorHops only
+	rejects a relay pretending to be the origin, not a relay pretending to be closer to it than it is
+ */
+func (rumor *RumorMessage) signedContent() []byte {
+	return concatFields("RUMOR", []byte(rumor.Origin), uint64ToBytes(uint64(rumor.ID)), []byte(rumor.Text),
+		rumor.EncryptionKey, []byte(rumor.OriginAddr))
+}
+
+/*
+	signedContent returns the bytes covered by the signature of a private message. The hop limit is not signed,
+	since it is decreased by every peer that forwards the message
+ */
+func (private *PrivateMessage) signedContent() []byte {
+	return concatFields("PRIVATE", []byte(private.Origin), uint64ToBytes(uint64(private.ID)),
+		[]byte(private.Destination), []byte(private.Text), private.EncryptedText, private.EphemeralKey, private.Nonce)
+}
+
+/*
+	signedContent returns the bytes covered by the signature of a private acknowledgement, hop limit excepted
+ */
+func (ack *PrivateAck) signedContent() []byte {
+	return concatFields("PRIVATEACK", []byte(ack.Origin), []byte(ack.Destination), uint64ToBytes(uint64(ack.ID)))
+}
+
+/*
+	signedContent returns the bytes covered by the signature of a search reply, hop limit excepted
+ */
+func (searchReply *SearchReply) signedContent() []byte {
+	fields := [][]byte{[]byte(searchReply.Origin), []byte(searchReply.Destination)}
+	for _, result := range searchReply.Results {
+		chunkMap := make([]byte, 0)
+		for _, chunk := range result.ChunkMap {
+			chunkMap = append(chunkMap, uint64ToBytes(chunk)...)
+		}
+		fields = append(fields, []byte(result.FileName), result.MetafileHash, chunkMap,
+			uint64ToBytes(result.ChunkCount))
+	}
+	return concatFields("SEARCHREPLY", fields...)
+}
+
+/*
+	signedContent returns the bytes covered by the signature of a data reply, hop limit excepted
+ */
+func (dataReply *DataReply) signedContent() []byte {
+	return concatFields("DATAREPLY", []byte(dataReply.Origin), []byte(dataReply.Destination),
+		dataReply.HashValue, dataReply.Data)
+}
+
+/*
+	concatFields encodes a tag followed by the given fields, each of them prefixed by its length, so that two
+	different packets can never have the same encoding
+ */
+func concatFields(tag string, fields ...[]byte) []byte {
+	content := []byte(tag)
+	for _, field := range fields {
+		length := make([]byte, 4)
+		binary.BigEndian.PutUint32(length, uint32(len(field)))
+		content = append(content, length...)
+		content = append(content, field...)
+	}
+	return content
+}
+
+/*
+	uint64ToBytes returns the big-endian encoding of the given number
+ */
+func uint64ToBytes(n uint64) []byte {
+	encoded := make([]byte, 8)
+	binary.BigEndian.PutUint64(encoded, n)
+	return encoded
+}
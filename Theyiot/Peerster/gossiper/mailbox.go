@@ -0,0 +1,146 @@
+package gossiper
+
+import (
+	"fmt"
+	"github.com/Theyiot/Peerster/constants"
+	"github.com/Theyiot/Peerster/util"
+	"math/rand"
+	"net"
+)
+
+/*
+	receiveMailboxDeposit handles the packets of MailboxDeposit type. Another peer asks us to keep a private message
+	for a destination it can not reach, and to deliver it as soon as we know a route to that destination
+ */
+func (gossiper *Gossiper) receiveMailboxDeposit(gossipPacket GossipPacket, addr *net.UDPAddr) {
+	private := gossipPacket.MailboxDeposit.Private
+	if err := gossiper.verifyOrigin(private.Origin, private.PublicKey, private.signedContent(), private.Signature); err != nil {
+		println("ERROR : rejecting mailbox deposit from " + addr.String() + " : " + err.Error())
+		return
+	}
+	if private.Origin == gossiper.Name {
+		return
+	} else if private.Destination == gossiper.Name {
+		gossiper.receivePrivatePacket(GossipPacket{Private: &private}, addr)
+		return
+	}
+
+	gossiper.addToMailbox(private)
+	gossiper.publish(MailboxDeposited{ Origin: private.Origin, Destination: private.Destination })
+	gossiper.flushMailbox(private.Destination)
+}
+
+/*
+	replicatePrivate gives a copy of one of our private messages to at most gossiper.MailboxReplicas of our
+	neighbours, so that the message can be delivered even if we are offline when a route to its destination appears
+ */
+func (gossiper *Gossiper) replicatePrivate(private PrivateMessage) {
+	if gossiper.MailboxReplicas == 0 {
+		return
+	}
+	if util.CheckAndPrintError(gossiper.finalizePrivate(&private)) {
+		return
+	}
+	addresses := gossiper.Peers.GetAddresses()
+	rand.Shuffle(len(addresses), func(i, j int) {
+		addresses[i], addresses[j] = addresses[j], addresses[i]
+	})
+	for i := 0 ; i < len(addresses) && i < int(gossiper.MailboxReplicas) ; i++ {
+		deposit := MailboxDeposit{Private: private}
+		gossiper.send(PacketToSend{GossipPacket: &GossipPacket{MailboxDeposit: &deposit}, Address: addresses[i]})
+	}
+}
+
+/*
+	addToMailbox queues a private message until it can be delivered. Our own messages stay in the mailbox until
+	they are acknowledged. When the mailbox of a destination is full, its oldest message is dropped
+ */
+func (gossiper *Gossiper) addToMailbox(private PrivateMessage) {
+	gossiper.PrivatesLock.Lock()
+	defer gossiper.PrivatesLock.Unlock()
+	queued, _ := gossiper.Mailbox.LoadOrStore(private.Destination, make([]PrivateMessage, 0))
+	messages := make([]PrivateMessage, 0, len(queued.([]PrivateMessage)) + 1)
+	for _, message := range queued.([]PrivateMessage) {
+		if message.Origin == private.Origin && message.ID == private.ID {
+			return
+		}
+		messages = append(messages, message)
+	}
+	messages = append(messages, private)
+
+	if len(messages) > constants.MAX_MAILBOX_SIZE {
+		dropped := messages[0]
+		messages = messages[1:]
+		println("ERROR : the mailbox for " + private.Destination + " is full, dropping the message " +
+			fmt.Sprint(dropped.ID) + " of " + dropped.Origin)
+		if dropped.Origin == gossiper.Name {
+			key := privateMessageKey(dropped.Destination, dropped.ID)
+			gossiper.PrivateStatuses.Store(key, constants.PRIVATE_STATUS_FAILED)
+			gossiper.persist(constants.BUCKET_PRIVATE_STATUSES, key, constants.PRIVATE_STATUS_FAILED)
+		}
+	}
+	gossiper.Mailbox.Store(private.Destination, messages)
+	gossiper.persist(constants.BUCKET_MAILBOX, private.Destination, messages)
+}
+
+/*
+	removeFromMailbox removes from the mailbox of the destination the message with the given origin and ID
+ */
+func (gossiper *Gossiper) removeFromMailbox(destination, origin string, id uint32) {
+	gossiper.PrivatesLock.Lock()
+	defer gossiper.PrivatesLock.Unlock()
+	queued, exist := gossiper.Mailbox.Load(destination)
+	if !exist {
+		return
+	}
+	messages := make([]PrivateMessage, 0)
+	for _, message := range queued.([]PrivateMessage) {
+		if message.Origin != origin || message.ID != id {
+			messages = append(messages, message)
+		}
+	}
+	if len(messages) == 0 {
+		gossiper.Mailbox.Delete(destination)
+		if gossiper.Storage != nil {
+			util.CheckAndPrintError(gossiper.Storage.Delete(constants.BUCKET_MAILBOX, destination))
+		}
+		return
+	}
+	gossiper.Mailbox.Store(destination, messages)
+	gossiper.persist(constants.BUCKET_MAILBOX, destination, messages)
+}
+
+/*
+	flushMailbox delivers the messages queued for the given destination, if we know a route to it
+ */
+func (gossiper *Gossiper) flushMailbox(destination string) {
+	if _, exist := gossiper.DSDV.GetNextHop(destination); !exist {
+		return
+	}
+	queued, exist := gossiper.Mailbox.Load(destination)
+	if !exist {
+		return
+	}
+	for _, private := range queued.([]PrivateMessage) {
+		if private.Origin == gossiper.Name {
+			private := private
+			gossiper.spawn(func() { gossiper.deliverPrivate(private) })
+			continue
+		}
+
+		// WE ONLY KEEP THE MESSAGES OF THE OTHER PEERS UNTIL WE HAND THEM TO THE NEXT HOP
+		privateCopy := private
+		gossiper.forwardPrivatePacket(GossipPacket{Private: &privateCopy}, "")
+		gossiper.removeFromMailbox(destination, private.Origin, private.ID)
+	}
+}
+
+/*
+	flushMailboxes delivers the queued messages of all the destinations to which we know a route
+ */
+func (gossiper *Gossiper) flushMailboxes() {
+	gossiper.Mailbox.Range(func(destination, _ interface{}) bool {
+		gossiper.flushMailbox(destination.(string))
+		return true
+	})
+}
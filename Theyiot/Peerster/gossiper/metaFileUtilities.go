@@ -0,0 +1,144 @@
+package gossiper
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"github.com/Theyiot/Peerster/constants"
+)
+
+/*
+	A file that has at most constants.CHUNK_SIZE / sha256.Size chunks is described by a single metafile, which is
+	simply the concatenation of the hashes of its chunks, exactly as before. Bigger files are described by a tree
+	of metafiles : the leaves are such simple metafiles and every other node starts with a header made of
+	constants.METAFILE_MAGIC followed by its level (the number of metafile levels below it, in big endian), and
+	then the hashes of its children. Since the header size is not a multiple of sha256.Size, a node can never be
+	mistaken for a simple metafile, and each node still fits in a single DataReply
+ */
+
+/*
+	hashesPerMetaFile returns the number of hashes a simple metafile can hold
+ */
+func hashesPerMetaFile() int {
+	return constants.CHUNK_SIZE / sha256.Size
+}
+
+/*
+	hashesPerMetaFileNode returns the number of hashes a node of a metafile tree can hold, taking into
+	account its header
+ */
+func hashesPerMetaFileNode() int {
+	return (constants.CHUNK_SIZE - constants.METAFILE_HEADER_SIZE) / sha256.Size
+}
+
+/*
+	buildMetaFile takes the hashes of all the chunks of a file and returns the metafile describing it. If the
+	file is too big for a simple metafile, the intermediate metafiles are written in the "._FileChunks" folder
+	and the returned metafile is the root of the tree
+ */
+func buildMetaFile(hashes [][]byte) ([]byte, error) {
+	if len(hashes) <= hashesPerMetaFile() {
+		return concatHashes(hashes), nil
+	}
+
+	//LEAVES ARE SIMPLE METAFILES
+	level := uint32(0)
+	nodeSize := hashesPerMetaFile()
+	for len(hashes) > hashesPerMetaFileNode() || level == 0 {
+		nodesHashes := make([][]byte, 0)
+		for i := 0 ; i < len(hashes) ; i += nodeSize {
+			end := i + nodeSize
+			if end > len(hashes) {
+				end = len(hashes)
+			}
+			node := concatHashes(hashes[i:end])
+			if level > 0 {
+				node = append(metaFileHeader(level), node...)
+			}
+			nodeHash := sha256.Sum256(node)
+			if err := writeChunk(hex.EncodeToString(nodeHash[:]), node); err != nil {
+				return nil, err
+			}
+			nodesHashes = append(nodesHashes, nodeHash[:])
+		}
+		hashes = nodesHashes
+		nodeSize = hashesPerMetaFileNode()
+		level++
+	}
+
+	return append(metaFileHeader(level), concatHashes(hashes)...), nil
+}
+
+/*
+	resolveMetaFile walks the tree of metafiles whose root is given, and returns the list of the hashes of the
+	data chunks, in order. The sub-metafiles are obtained through the fetch function, which returns false if it
+	could not provide the metafile. A simple metafile is simply split into its hashes
+ */
+func resolveMetaFile(metaFile []byte, fetch func(hashHex string) ([]byte, bool)) ([][]byte, bool) {
+	level, hashes, isNode := parseMetaFileNode(metaFile)
+	if !isNode {
+		if len(metaFile) % sha256.Size != 0 {
+			println("ERROR : metafile has an invalid size of " + fmt.Sprint(len(metaFile)) + " bytes")
+			return nil, false
+		}
+		return getHashesAsList(metaFile), true
+	}
+
+	chunks := make([][]byte, 0)
+	for _, hash := range hashes {
+		child, success := fetch(hex.EncodeToString(hash))
+		if !success {
+			return nil, false
+		}
+		childLevel, _, childIsNode := parseMetaFileNode(child)
+		if (level == 1 && childIsNode) || (level > 1 && (!childIsNode || childLevel != level - 1)) {
+			println("ERROR : metafile " + hex.EncodeToString(hash) + " is not at the expected level of the tree")
+			return nil, false
+		}
+		childChunks, success := resolveMetaFile(child, fetch)
+		if !success {
+			return nil, false
+		}
+		chunks = append(chunks, childChunks...)
+	}
+	return chunks, true
+}
+
+/*
+	parseMetaFileNode checks whether the given metafile is a node of a metafile tree. If it is the case, it returns
+	its level and the hashes of its children
+ */
+func parseMetaFileNode(metaFile []byte) (uint32, [][]byte, bool) {
+	if len(metaFile) < constants.METAFILE_HEADER_SIZE ||
+		(len(metaFile) - constants.METAFILE_HEADER_SIZE) % sha256.Size != 0 ||
+		string(metaFile[:len(constants.METAFILE_MAGIC)]) != constants.METAFILE_MAGIC {
+		return 0, nil, false
+	}
+	level := binary.BigEndian.Uint32(metaFile[len(constants.METAFILE_MAGIC):constants.METAFILE_HEADER_SIZE])
+	if level == 0 {
+		return 0, nil, false
+	}
+	return level, getHashesAsList(metaFile[constants.METAFILE_HEADER_SIZE:]), true
+}
+
+/*
+	metaFileHeader returns the header of a node of a metafile tree for the given level
+ */
+func metaFileHeader(level uint32) []byte {
+	header := make([]byte, constants.METAFILE_HEADER_SIZE)
+	copy(header, constants.METAFILE_MAGIC)
+	binary.BigEndian.PutUint32(header[len(constants.METAFILE_MAGIC):], level)
+	return header
+}
+
+/*
+	concatHashes concatenates the given hashes into a single array of bytes
+ */
+func concatHashes(hashes [][]byte) []byte {
+	concatenated := make([]byte, 0, len(hashes) * sha256.Size)
+	for _, hash := range hashes {
+		concatenated = append(concatenated, hash...)
+	}
+	return concatenated
+}
@@ -0,0 +1,153 @@
+package gossiper
+
+import (
+	"encoding/hex"
+	"github.com/Theyiot/Peerster/constants"
+	"net"
+	"sync"
+	"time"
+)
+
+/*
+	OrphanBlocksSet keeps the blocks we received before their parent, until the missing ancestors are obtained
+ */
+type OrphanBlocksSet struct {
+	blocks		map[string]orphanBlock	//Map[blockHash]orphanBlock
+	children	map[string][]string		//Map[prevHash][]blockHash
+	lock		sync.RWMutex
+}
+
+/*
+	An orphanBlock is a buffered block, with the peer that sent it and the time at which it was received
+ */
+type orphanBlock struct {
+	block		Block
+	from		*net.UDPAddr
+	received	time.Time
+}
+
+/*
+	Add buffers an orphan block sent by the given peer. It returns false if the block was already buffered. If the
+	set is full, the oldest orphan block is dropped to make room for the new one
+ */
+func (set *OrphanBlocksSet) Add(block Block, from *net.UDPAddr, now time.Time) bool {
+	hash := block.Hash()
+	hashHex, prevHashHex := hex.EncodeToString(hash[:]), hex.EncodeToString(block.PrevHash[:])
+	set.lock.Lock()
+	defer set.lock.Unlock()
+	if _, exist := set.blocks[hashHex]; exist {
+		return false
+	}
+	if len(set.blocks) >= constants.MAX_ORPHAN_BLOCKS {
+		oldestHashHex, oldest := "", now
+		for orphanHashHex, orphan := range set.blocks {
+			if oldestHashHex == "" || orphan.received.Before(oldest) {
+				oldestHashHex, oldest = orphanHashHex, orphan.received
+			}
+		}
+		set.remove(oldestHashHex)
+	}
+	set.blocks[hashHex] = orphanBlock{ block: block, from: from, received: now }
+	set.children[prevHashHex] = append(set.children[prevHashHex], hashHex)
+	return true
+}
+
+/*
+	TakeChildren removes from the set and returns the orphan blocks whose parent is the given block
+ */
+func (set *OrphanBlocksSet) TakeChildren(prevHashHex string) []Block {
+	set.lock.Lock()
+	defer set.lock.Unlock()
+	children := make([]Block, 0)
+	for _, hashHex := range set.children[prevHashHex] {
+		children = append(children, set.blocks[hashHex].block)
+		delete(set.blocks, hashHex)
+	}
+	delete(set.children, prevHashHex)
+	return children
+}
+
+/*
+	Expire removes the orphan blocks that were received more than maxAge ago, and returns how many were removed
+ */
+func (set *OrphanBlocksSet) Expire(maxAge time.Duration, now time.Time) int {
+	set.lock.Lock()
+	defer set.lock.Unlock()
+	expired := 0
+	for hashHex, orphan := range set.blocks {
+		if now.Sub(orphan.received) > maxAge {
+			set.remove(hashHex)
+			expired++
+		}
+	}
+	return expired
+}
+
+/*
+	MissingAncestor follows the chain of buffered orphan blocks from the given block, and returns the hash of the
+	first ancestor that is not buffered. If the given block is not buffered, its hash is returned
+ */
+func (set *OrphanBlocksSet) MissingAncestor(hashHex string) string {
+	set.lock.RLock()
+	defer set.lock.RUnlock()
+	for {
+		orphan, exist := set.blocks[hashHex]
+		if !exist {
+			return hashHex
+		}
+		hashHex = hex.EncodeToString(orphan.block.PrevHash[:])
+	}
+}
+
+/*
+	MissingAncestors returns the hashes of the parents of the orphan blocks that are not buffered themselves, with
+	a peer that sent us one of their children
+ */
+func (set *OrphanBlocksSet) MissingAncestors() map[string]*net.UDPAddr {
+	set.lock.RLock()
+	defer set.lock.RUnlock()
+	missing := make(map[string]*net.UDPAddr)
+	for prevHashHex, children := range set.children {
+		if _, exist := set.blocks[prevHashHex]; !exist && len(children) > 0 {
+			missing[prevHashHex] = set.blocks[children[0]].from
+		}
+	}
+	return missing
+}
+
+/*
+	Size returns the number of orphan blocks in the set
+ */
+func (set *OrphanBlocksSet) Size() int {
+	set.lock.RLock()
+	defer set.lock.RUnlock()
+	return len(set.blocks)
+}
+
+/*
+	remove removes an orphan block from the set. The lock must be held by the caller
+ */
+func (set *OrphanBlocksSet) remove(hashHex string) {
+	orphan, exist := set.blocks[hashHex]
+	if !exist {
+		return
+	}
+	delete(set.blocks, hashHex)
+	prevHashHex := hex.EncodeToString(orphan.block.PrevHash[:])
+	siblings := set.children[prevHashHex]
+	for i, sibling := range siblings {
+		if sibling == hashHex {
+			siblings = append(siblings[:i], siblings[i + 1:]...)
+			break
+		}
+	}
+	if len(siblings) == 0 {
+		delete(set.children, prevHashHex)
+	} else {
+		set.children[prevHashHex] = siblings
+	}
+}
+
+func createOrphanBlocksSet() *OrphanBlocksSet {
+	return &OrphanBlocksSet{ blocks: make(map[string]orphanBlock), children: make(map[string][]string) }
+}
@@ -0,0 +1,55 @@
+package gossiper
+
+import (
+	"github.com/Theyiot/Peerster/constants"
+	"net"
+	"time"
+)
+
+/*
+	peerExchange periodically sends a sample of our peers to a random peer, which answers with a sample of its
+	own peers. This way, a node that only knows one bootstrap peer ends up knowing a healthy part of the network
+ */
+func (gossiper *Gossiper) peerExchange(timer uint) {
+	ticker := gossiper.Clock.NewTicker(time.Duration(timer) * time.Second)
+	defer ticker.Stop()
+	for gossiper.wait(ticker.C) {
+		if !gossiper.Peers.IsEmpty() {
+			gossiper.sendPeerExchange(gossiper.Peers.ChooseRandomPeer(), false)
+		}
+	}
+}
+
+/*
+	sendPeerExchange sends to the given peer a random sample of our other peers, preferring the ones that were
+	recently alive
+ */
+func (gossiper *Gossiper) sendPeerExchange(addr *net.UDPAddr, isReply bool) {
+	sample := gossiper.Peers.SamplePeers(constants.PEER_EXCHANGE_SAMPLE_SIZE, addr.String(),
+		constants.PEER_RECENTLY_ALIVE * time.Second)
+	peerExchange := PeerExchange{Peers: sample, IsReply: isReply}
+	gossiper.send(PacketToSend{GossipPacket: &GossipPacket{PeerExchange: &peerExchange}, Address: addr})
+}
+
+/*
+	receivePeerExchange handles the packets of PeerExchange type. We add the peers we did not know, as long as we
+	know less than constants.MAX_PEERS peers, and answer with a sample of our own peers if the packet was not
+	already an answer. An answer may confirm that we can route directly to an origin
+ */
+func (gossiper *Gossiper) receivePeerExchange(gossipPacket GossipPacket, addr *net.UDPAddr) {
+	added := make([]string, 0)
+	for _, peer := range gossipPacket.PeerExchange.Peers {
+		if peer != gossiper.GossipAddr && gossiper.Peers.AddBounded(peer, constants.MAX_PEERS) {
+			added = append(added, peer)
+		}
+	}
+	if len(added) > 0 {
+		gossiper.publish(PeersExchanged{ From: addr.String(), Added: added, Peers: gossiper.peerList() })
+	}
+
+	if !gossipPacket.PeerExchange.IsReply {
+		gossiper.sendPeerExchange(addr, true)
+	} else {
+		gossiper.confirmDirectRoute(addr)
+	}
+}
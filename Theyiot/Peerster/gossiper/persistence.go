@@ -0,0 +1,218 @@
+package gossiper
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/Theyiot/Peerster/constants"
+	"github.com/Theyiot/Peerster/util"
+	"net"
+)
+
+/*
+	loadState reloads the rumors, vector clock, private messages with their statuses and mailbox, routes, public and
+	encryption keys, indexed files and blockchain that were stored by a previous run of the gossiper. It must be
+	called before the gossiper starts to communicate
+ */
+func (gossiper *Gossiper) loadState() {
+	if gossiper.Storage == nil {
+		return
+	}
+
+	gossiper.Storage.Range(constants.BUCKET_RUMORS, func(key string, value []byte) bool {
+		var rumor GossipPacketTimed
+		if !util.CheckAndPrintError(json.Unmarshal(value, &rumor)) && rumor.GossipPacket.Rumor != nil {
+			gossiper.Rumors.Store(key, rumor)
+		}
+		return true
+	})
+	gossiper.Storage.Range(constants.BUCKET_VECTOR_CLOCK, func(origin string, value []byte) bool {
+		var nextID uint32
+		if !util.CheckAndPrintError(json.Unmarshal(value, &nextID)) {
+			gossiper.VectorClock.Store(origin, nextID)
+		}
+		return true
+	})
+	gossiper.Storage.Range(constants.BUCKET_PRIVATES, func(peerName string, value []byte) bool {
+		var messages []GossipPacketTimed
+		if util.CheckAndPrintError(json.Unmarshal(value, &messages)) {
+			return true
+		}
+		gossiper.Privates.Store(peerName, messages)
+		for _, message := range messages {
+			private := message.GossipPacket.Private
+			if private == nil || private.ID == 0 {
+				continue
+			}
+			if private.Origin == gossiper.Name {
+				lastID, exist := gossiper.PrivateIDs.Load(peerName)
+				if !exist || lastID.(uint32) < private.ID {
+					gossiper.PrivateIDs.Store(peerName, private.ID)
+				}
+			} else {
+				gossiper.ReceivedPrivates.Store(privateMessageKey(peerName, private.ID), Signal{})
+			}
+		}
+		return true
+	})
+	gossiper.Storage.Range(constants.BUCKET_PRIVATE_STATUSES, func(key string, value []byte) bool {
+		var status string
+		if util.CheckAndPrintError(json.Unmarshal(value, &status)) {
+			return true
+		}
+		//THE PENDING MESSAGES WAIT IN THE MAILBOX UNTIL THEY ARE SENT AGAIN
+		if status == constants.PRIVATE_STATUS_PENDING {
+			status = constants.PRIVATE_STATUS_QUEUED
+			gossiper.persist(constants.BUCKET_PRIVATE_STATUSES, key, status)
+		}
+		gossiper.PrivateStatuses.Store(key, status)
+		return true
+	})
+	gossiper.Storage.Range(constants.BUCKET_MAILBOX, func(destination string, value []byte) bool {
+		var messages []PrivateMessage
+		if !util.CheckAndPrintError(json.Unmarshal(value, &messages)) {
+			gossiper.Mailbox.Store(destination, messages)
+		}
+		return true
+	})
+	gossiper.Storage.Range(constants.BUCKET_DSDV, func(origin string, value []byte) bool {
+		var entry util.RouteEntry
+		if !util.CheckAndPrintError(json.Unmarshal(value, &entry)) {
+			gossiper.DSDV.Restore(entry)
+		}
+		return true
+	})
+	gossiper.Storage.Range(constants.BUCKET_PUBLIC_KEYS, func(origin string, value []byte) bool {
+		var publicKeyHex string
+		if util.CheckAndPrintError(json.Unmarshal(value, &publicKeyHex)) {
+			return true
+		}
+		publicKey, err := hex.DecodeString(publicKeyHex)
+		if !util.CheckAndPrintError(err) && len(publicKey) == ed25519.PublicKeySize {
+			gossiper.PublicKeys.Store(origin, ed25519.PublicKey(publicKey))
+		}
+		return true
+	})
+	gossiper.Storage.Range(constants.BUCKET_ENCRYPTION_KEYS, func(origin string, value []byte) bool {
+		var encryptionKeyHex string
+		if util.CheckAndPrintError(json.Unmarshal(value, &encryptionKeyHex)) {
+			return true
+		}
+		encryptionKey, err := hex.DecodeString(encryptionKeyHex)
+		if !util.CheckAndPrintError(err) {
+			gossiper.EncryptionKeys.Store(origin, encryptionKey)
+		}
+		return true
+	})
+	gossiper.Storage.Range(constants.BUCKET_INDEXED_FILES, func(metaHashHex string, value []byte) bool {
+		var indexedFile IndexedFile
+		if !util.CheckAndPrintError(json.Unmarshal(value, &indexedFile)) {
+			gossiper.IndexedFiles.Store(metaHashHex, indexedFile)
+		}
+		return true
+	})
+	gossiper.Storage.Range(constants.BUCKET_BLOCKCHAIN, func(hashHex string, value []byte) bool {
+		var block Block
+		if !util.CheckAndPrintError(json.Unmarshal(value, &block)) {
+			gossiper.Blockchain.Store(hashHex, block)
+		}
+		return true
+	})
+
+	value, exist := gossiper.Storage.Get(constants.BUCKET_CURRENT_BLOCK, constants.BUCKET_CURRENT_BLOCK)
+	var currentBlock CurrentBlockState
+	if exist && !util.CheckAndPrintError(json.Unmarshal(value, &currentBlock)) {
+		gossiper.CurrentBlock.SetCurrentHash(currentBlock.HashHex)
+		gossiper.CurrentBlock.SetDepth(currentBlock.Depth)
+	}
+
+	//THE NAMES ARE THE ONES BOUND ON THE MAIN CHAIN
+	hashHex := gossiper.CurrentBlock.GetCurrentHash()
+	for {
+		block, exist := gossiper.Blockchain.Load(hashHex)
+		if !exist {
+			break
+		}
+		for _, transaction := range block.(Block).Transactions {
+			gossiper.NameToMetaHash.Store(transaction.File.Name, transaction.File.MetafileHash)
+		}
+		prevHash := block.(Block).PrevHash
+		hashHex = hex.EncodeToString(prevHash[:])
+	}
+}
+
+/*
+	persist stores the JSON encoding of the value under the given key of the bucket, if the gossiper has a storage
+ */
+func (gossiper *Gossiper) persist(bucket, key string, value interface{}) {
+	if gossiper.Storage == nil {
+		return
+	}
+	bytes, err := json.Marshal(value)
+	if util.CheckAndPrintError(err) {
+		return
+	}
+	util.CheckAndPrintError(gossiper.Storage.Put(bucket, key, bytes))
+}
+
+/*
+	storeRumor stores a rumor both in memory and on the disk
+ */
+func (gossiper *Gossiper) storeRumor(key string, rumor GossipPacketTimed) {
+	gossiper.Rumors.Store(key, rumor)
+	gossiper.persist(constants.BUCKET_RUMORS, key, rumor)
+}
+
+/*
+	storeNextID stores the next ID we expect from the given origin both in memory and on the disk
+ */
+func (gossiper *Gossiper) storeNextID(origin string, nextID uint32) {
+	gossiper.VectorClock.Store(origin, nextID)
+	gossiper.persist(constants.BUCKET_VECTOR_CLOCK, origin, nextID)
+}
+
+/*
+	updateRoute proposes to the routing table a route towards the origin through the given address, with the
+	sequence number, the hop count and the type of the packet that taught it to us. An accepted route is stored on
+	the disk
+ */
+func (gossiper *Gossiper) updateRoute(origin string, addr *net.UDPAddr, seq, hops uint32, learnedFrom string) {
+	if origin == gossiper.Name {
+		return
+	}
+	oldEntry, known := gossiper.DSDV.GetEntry(origin)
+	if !gossiper.DSDV.Update(origin, addr, seq, hops, learnedFrom) {
+		return
+	}
+	entry, _ := gossiper.DSDV.GetEntry(origin)
+	gossiper.persist(constants.BUCKET_DSDV, origin, entry)
+	if !known || oldEntry.NextHop.String() != addr.String() {
+		gossiper.publish(RouteUpdated{ Destination: origin, NextHop: addr.String(), Seq: seq, Hops: hops,
+			LearnedFrom: learnedFrom })
+	}
+}
+
+/*
+	storeIndexedFile stores an indexed file both in memory and on the disk
+ */
+func (gossiper *Gossiper) storeIndexedFile(metaHashHex string, indexedFile IndexedFile) {
+	gossiper.IndexedFiles.Store(metaHashHex, indexedFile)
+	gossiper.persist(constants.BUCKET_INDEXED_FILES, metaHashHex, indexedFile)
+}
+
+/*
+	storeBlock stores a block both in memory and on the disk
+ */
+func (gossiper *Gossiper) storeBlock(hashHex string, block Block) {
+	gossiper.Blockchain.Store(hashHex, block)
+	gossiper.persist(constants.BUCKET_BLOCKCHAIN, hashHex, block)
+}
+
+/*
+	persistCurrentBlock stores the head of the main chain and its depth on the disk
+ */
+func (gossiper *Gossiper) persistCurrentBlock() {
+	currentBlock := CurrentBlockState{HashHex: gossiper.CurrentBlock.GetCurrentHash(),
+		Depth: gossiper.CurrentBlock.GetDepth()}
+	gossiper.persist(constants.BUCKET_CURRENT_BLOCK, constants.BUCKET_CURRENT_BLOCK, currentBlock)
+}
@@ -0,0 +1,166 @@
+package gossiper
+
+import (
+	"fmt"
+	"github.com/Theyiot/Peerster/constants"
+	"github.com/Theyiot/Peerster/util"
+	"net"
+	"time"
+)
+
+/*
+	receivePrivateAck handles the packets of PrivateAck type. An acknowledgement destined to us marks the private
+	message with the same ID as delivered, removes it from the mailbox and stops its retransmissions
+ */
+func (gossiper *Gossiper) receivePrivateAck(gossipPacket GossipPacket, addr *net.UDPAddr) {
+	ack := gossipPacket.PrivateAck
+	if err := gossiper.verifyOrigin(ack.Origin, ack.PublicKey, ack.signedContent(), ack.Signature); err != nil {
+		println("ERROR : rejecting private acknowledgement from " + addr.String() + " : " + err.Error())
+		return
+	}
+	if ack.Destination != gossiper.Name {
+		gossiper.forwardPrivateAck(gossipPacket)
+		return
+	}
+
+	key := privateMessageKey(ack.Origin, ack.ID)
+	gossiper.removeFromMailbox(ack.Origin, gossiper.Name, ack.ID)
+	if !gossiper.setPrivateStatus(key, constants.PRIVATE_STATUS_DELIVERED) {
+		return
+	}
+	gossiper.publish(PrivateAcknowledged{ Origin: ack.Origin, ID: ack.ID })
+	if channel, exist := gossiper.PrivateAcks.Load(key); exist {
+		select { // NON-BLOCKING SEND, THE MESSAGE MAY ALREADY HAVE BEEN ACKNOWLEDGED
+		case channel.(chan Signal) <- Signal{}:
+		default:
+		}
+	}
+}
+
+/*
+	sendPrivateAck acknowledges to its origin the reception of a private message. The acknowledgement goes back
+	through the peer that gave us the message if we don't have a route to its origin
+ */
+func (gossiper *Gossiper) sendPrivateAck(private *PrivateMessage, addr *net.UDPAddr) {
+	ack := PrivateAck{Origin: gossiper.Name, Destination: private.Origin, ID: private.ID,
+		HopLimit: constants.DEFAULT_HOP_LIMIT}
+	gossiper.signPrivateAck(&ack)
+	if nextHopAddr, exist := gossiper.DSDV.GetNextHop(private.Origin); exist {
+		addr = nextHopAddr
+	}
+	gossiper.send(PacketToSend{GossipPacket: &GossipPacket{PrivateAck: &ack}, Address: addr})
+}
+
+/*
+	forwardPrivateAck takes care of forwarding a point-to-point private acknowledgement to the right peer
+ */
+func (gossiper *Gossiper) forwardPrivateAck(gossipPacket GossipPacket) {
+	//WE DECREASE AND DISCARD INVALID PACKET
+	gossipPacket.PrivateAck.HopLimit--
+	if gossipPacket.PrivateAck.HopLimit == 0 {
+		return
+	}
+
+	nextHopAddr, exist := gossiper.DSDV.GetNextHop(gossipPacket.PrivateAck.Destination)
+	if !exist {
+		println("ERROR : don't know how to forward to " + gossipPacket.PrivateAck.Destination)
+		return
+	}
+
+	packetToSend := PacketToSend{Address: nextHopAddr, GossipPacket: &gossipPacket}
+	gossiper.send(packetToSend)
+}
+
+/*
+	deliverPrivate sends a private message of our mailbox to its destination, and sends it again every
+	constants.PRIVATE_ACK_TIMEOUT seconds until it is acknowledged. After constants.MAX_PRIVATE_ATTEMPTS attempts
+	without acknowledgement, the message is given to the mailboxes of our neighbours and marked as queued, or marked
+	as failed if we don't replicate messages. In both cases it stays in our mailbox, and is sent again at the next
+	sign of life of the destination
+ */
+func (gossiper *Gossiper) deliverPrivate(private PrivateMessage) {
+	key := privateMessageKey(private.Destination, private.ID)
+	ackChannel := make(chan Signal, 1)
+	if _, inFlight := gossiper.PrivateAcks.LoadOrStore(key, ackChannel); inFlight {
+		return
+	}
+	defer gossiper.PrivateAcks.Delete(key)
+	if status, _ := gossiper.PrivateStatuses.Load(key); status == constants.PRIVATE_STATUS_DELIVERED {
+		gossiper.removeFromMailbox(private.Destination, private.Origin, private.ID)
+		return
+	}
+	gossiper.setPrivateStatus(key, constants.PRIVATE_STATUS_PENDING)
+	original := private
+	if util.CheckAndPrintError(gossiper.finalizePrivate(&private)) {
+		return
+	}
+
+	for attempt := 0 ; attempt < constants.MAX_PRIVATE_ATTEMPTS ; attempt++ {
+		// THE ROUTE TO THE DESTINATION MAY CHANGE BETWEEN TWO ATTEMPTS
+		if addr, exist := gossiper.DSDV.GetNextHop(private.Destination); exist {
+			privateCopy := private
+			gossiper.send(PacketToSend{GossipPacket: &GossipPacket{Private: &privateCopy}, Address: addr})
+		}
+
+		timer := gossiper.Clock.NewTimer(constants.PRIVATE_ACK_TIMEOUT * time.Second)
+		select {
+		case <- ackChannel:
+			timer.Stop()
+			return
+		case <- gossiper.Done():
+			timer.Stop()
+			return
+		case <- timer.C:
+		}
+	}
+
+	// THE MESSAGE IS ONLY QUEUED IF THE MAILBOXES OF OUR NEIGHBOURS CAN TRY TO DELIVER IT WHILE WE ARE OFFLINE
+	if gossiper.MailboxReplicas == 0 {
+		if gossiper.setPrivateStatus(key, constants.PRIVATE_STATUS_FAILED) {
+			println("ERROR : the private message " + fmt.Sprint(private.ID) + " to " + private.Destination +
+				" was not acknowledged after " + fmt.Sprint(constants.MAX_PRIVATE_ATTEMPTS) + " attempts")
+		}
+		return
+	}
+	gossiper.replicatePrivate(original)
+	if gossiper.setPrivateStatus(key, constants.PRIVATE_STATUS_QUEUED) {
+		println("ERROR : the private message " + fmt.Sprint(private.ID) + " to " + private.Destination +
+			" was not acknowledged, keeping it in the mailboxes")
+	}
+}
+
+/*
+	nextPrivateID returns the ID of the next private message we send to the given destination. IDs start at 1, the
+	ID 0 being used by the peers that don't acknowledge private messages
+ */
+func (gossiper *Gossiper) nextPrivateID(destination string) uint32 {
+	gossiper.PrivatesLock.Lock()
+	defer gossiper.PrivatesLock.Unlock()
+	lastID, _ := gossiper.PrivateIDs.LoadOrStore(destination, uint32(0))
+	gossiper.PrivateIDs.Store(destination, lastID.(uint32) + 1)
+	return lastID.(uint32) + 1
+}
+
+/*
+	setPrivateStatus updates the status of one of our private messages, and returns false if it did not change. A
+	delivered message stays delivered, even if it was acknowledged after being marked as failed
+ */
+func (gossiper *Gossiper) setPrivateStatus(key, status string) bool {
+	gossiper.PrivatesLock.Lock()
+	defer gossiper.PrivatesLock.Unlock()
+	oldStatus, exist := gossiper.PrivateStatuses.Load(key)
+	if !exist || oldStatus.(string) == status || oldStatus.(string) == constants.PRIVATE_STATUS_DELIVERED {
+		return false
+	}
+	gossiper.PrivateStatuses.Store(key, status)
+	gossiper.persist(constants.BUCKET_PRIVATE_STATUSES, key, status)
+	return true
+}
+
+/*
+	privateMessageKey returns the key under which the private message with the given ID, exchanged with the given
+	peer, is tracked
+ */
+func privateMessageKey(peerName string, id uint32) string {
+	return fmt.Sprint(id) + "@" + peerName
+}
@@ -1,53 +1,97 @@
 package gossiper
 
 import (
-	"fmt"
 	"github.com/Theyiot/Peerster/constants"
 	"net"
-	"time"
 )
 
 /*
 	receivePrivatePacket handles the packets of private type
  */
-func (gossiper *Gossiper) receivePrivatePacket(gossipPacket GossipPacket, senderAddr string) {
+func (gossiper *Gossiper) receivePrivatePacket(gossipPacket GossipPacket, addr *net.UDPAddr) {
 	dest, origin := gossipPacket.Private.Destination, gossipPacket.Private.Origin
+	private := gossipPacket.Private
+	if err := gossiper.verifyOrigin(origin, private.PublicKey, private.signedContent(), private.Signature); err != nil {
+		println("ERROR : rejecting private message from " + addr.String() + " : " + err.Error())
+		return
+	}
 	if dest == gossiper.Name {
-		str := "PRIVATE origin " + origin + " hop-limit " + fmt.Sprint(gossipPacket.Private.HopLimit) +
-			" contents " + gossipPacket.Private.Text + gossiper.Peers.String()
-		gossiper.ToPrint <- str
+		//WE KEEP THE DECRYPTED TEXT OF ENCRYPTED MESSAGES
+		if len(private.EncryptedText) > 0 {
+			text, err := gossiper.Identity.decryptPrivate(private)
+			if err != nil {
+				println("ERROR : could not decrypt private message from " + origin + " : " + err.Error())
+				return
+			}
+			decrypted := *private
+			decrypted.Text = text
+			gossipPacket = GossipPacket{Private: &decrypted}
+		}
+
+		//MESSAGES WITH AN ID ARE ACKNOWLEDGED, AND RETRANSMISSIONS ARE ONLY ACKNOWLEDGED AGAIN
+		if private.ID > 0 {
+			gossiper.sendPrivateAck(private, addr)
+			_, duplicate := gossiper.ReceivedPrivates.LoadOrStore(privateMessageKey(origin, private.ID), Signal{})
+			if duplicate {
+				return
+			}
+		}
+
+		gossiper.publish(PrivateReceived{ Origin: origin, HopLimit: gossipPacket.Private.HopLimit,
+			Contents: gossipPacket.Private.Text, Peers: gossiper.peerList() })
 
 		gossiper.updatePrivates(gossipPacket, origin)
 		return
 	}
 
-	gossiper.forwardPrivatePacket(gossipPacket, senderAddr)
+	gossiper.forwardPrivatePacket(gossipPacket, addr.String())
 }
 
 /*
-	sendPrivatePacket takes care of sending a private message to a given peer
+	sendPrivatePacket takes care of sending a private message to a given peer. The message is kept in the mailbox
+	until the destination acknowledges it, and is only queued if we don't know a route to the destination yet
  */
 func (gossiper *Gossiper) sendPrivatePacket(content string, dest string) {
-	addr, exist := gossiper.DSDV.Load(dest)
-	if !exist {
-		println("ERROR : Trying to send a private message to an unknown peer, discarding this message")
+	gossiper.publish(ClientMessageReceived{ Contents: content, Peers: gossiper.peerList() })
+
+	privateMsg := PrivateMessage{Origin: gossiper.Name, Text: content, ID: gossiper.nextPrivateID(dest),
+		Destination: dest, HopLimit: constants.DEFAULT_HOP_LIMIT}
+	sentMsg := privateMsg
+	gossiper.updatePrivates(GossipPacket{Private: &sentMsg}, dest)
+	key := privateMessageKey(dest, privateMsg.ID)
+	gossiper.PrivateStatuses.Store(key, constants.PRIVATE_STATUS_QUEUED)
+	gossiper.persist(constants.BUCKET_PRIVATE_STATUSES, key, constants.PRIVATE_STATUS_QUEUED)
+	gossiper.addToMailbox(privateMsg)
+
+	if _, exist := gossiper.DSDV.GetNextHop(dest); !exist {
+		gossiper.publish(PrivateQueued{ ID: privateMsg.ID, Destination: dest })
+		gossiper.replicatePrivate(privateMsg)
 		return
 	}
-	str := "CLIENT MESSAGE " + content + gossiper.Peers.String()
-	gossiper.ToPrint <- str
-
-	privateMsg := PrivateMessage{Origin: gossiper.Name, Text: content, ID: 0, Destination: dest, HopLimit: constants.DEFAULT_HOP_LIMIT}
-	gossipPacket := GossipPacket{Private: &privateMsg}
-	gossiper.ToSend <- PacketToSend{GossipPacket: &gossipPacket, Address: addr.(*net.UDPAddr)}
+	gossiper.spawn(func() { gossiper.deliverPrivate(privateMsg) })
+}
 
-	gossiper.updatePrivates(gossipPacket, dest)
+/*
+	finalizePrivate prepares one of our private messages to be sent : only the destination can read it if we know
+	its key, and it is signed
+ */
+func (gossiper *Gossiper) finalizePrivate(private *PrivateMessage) error {
+	if encryptionKey, known := gossiper.EncryptionKeys.Load(private.Destination); known {
+		if err := private.encrypt(encryptionKey.([]byte)); err != nil {
+			return err
+		}
+	}
+	gossiper.signPrivate(private)
+	return nil
 }
 
 /*
 	updatePrivates adds the new private messages to the already received ones
  */
 func (gossiper *Gossiper) updatePrivates(gossipPacket GossipPacket, peerName string) {
-	gossipPacketTimed := GossipPacketTimed{GossipPacket: gossipPacket, Timestamp: time.Now()}
+	gossiper.PrivatesLock.Lock()
+	defer gossiper.PrivatesLock.Unlock()
+	gossipPacketTimed := GossipPacketTimed{GossipPacket: gossipPacket, Timestamp: gossiper.Clock.Now()}
 	destMessages, exist := gossiper.Privates.Load(peerName)
 	var messages []GossipPacketTimed
 	if !exist { //WE BEGIN OUR PRIVATE DISCUSSION WITH "DEST"
@@ -56,6 +100,7 @@ func (gossiper *Gossiper) updatePrivates(gossipPacket GossipPacket, peerName str
 		messages = append(destMessages.([]GossipPacketTimed), gossipPacketTimed)
 	}
 	gossiper.Privates.Store(peerName, messages)
+	gossiper.persist(constants.BUCKET_PRIVATES, peerName, messages)
 }
 
 /*
@@ -68,12 +113,12 @@ func (gossiper *Gossiper) forwardPrivatePacket(gossipPacket GossipPacket, sender
 		return
 	}
 
-	nextHopAddr, exist := gossiper.DSDV.Load(gossipPacket.Private.Destination)
+	nextHopAddr, exist := gossiper.DSDV.GetNextHop(gossipPacket.Private.Destination)
 	if !exist {
 		println("ERROR : don't know how to forward to " + gossipPacket.Private.Destination)
 		return
 	}
 
-	packetToSend := PacketToSend{Address: nextHopAddr.(*net.UDPAddr), GossipPacket: &gossipPacket}
-	gossiper.ToSend <- packetToSend
+	packetToSend := PacketToSend{Address: nextHopAddr, GossipPacket: &gossipPacket}
+	gossiper.send(packetToSend)
 }
\ No newline at end of file
@@ -2,6 +2,8 @@ package gossiper
 
 import (
 	"fmt"
+	"github.com/Theyiot/Peerster/constants"
+	"github.com/Theyiot/Peerster/util"
 	"net"
 	"time"
 )
@@ -10,15 +12,16 @@ import (
 	sendRumorPacket takes care of sending a rumor message to a given peer
  */
 func (gossiper *Gossiper) sendRumorPacket(content string) {
-	str := "CLIENT MESSAGE " + content + gossiper.Peers.String()
-	gossiper.ToPrint <- str
+	gossiper.publish(ClientMessageReceived{ Contents: content, Peers: gossiper.peerList() })
 	id, _ := gossiper.VectorClock.LoadOrStore(gossiper.Name, uint32(1))
 
-	rumorMessage := RumorMessage{Text: content, ID: id.(uint32), Origin: gossiper.Name}
+	rumorMessage := RumorMessage{Text: content, ID: id.(uint32), Origin: gossiper.Name,
+		OriginAddr: gossiper.advertisedAddress()}
+	gossiper.signRumor(&rumorMessage)
 	gossipPacket := GossipPacket{Rumor: &rumorMessage}
-	gossipPacketTimed := GossipPacketTimed{GossipPacket: gossipPacket, Timestamp: time.Now()}
-	gossiper.Rumors.Store(fmt.Sprint(id) + "@" + gossiper.Name, gossipPacketTimed)
-	gossiper.VectorClock.Store(gossiper.Name, id.(uint32)+uint32(1))
+	gossipPacketTimed := GossipPacketTimed{GossipPacket: gossipPacket, Timestamp: gossiper.Clock.Now()}
+	gossiper.storeRumor(fmt.Sprint(id) + "@" + gossiper.Name, gossipPacketTimed)
+	gossiper.storeNextID(gossiper.Name, id.(uint32)+uint32(1))
 
 	gossiper.broadcastGossipPacket(gossipPacket, gossiper.Peers.GetAddresses())
 }
@@ -29,36 +32,127 @@ func (gossiper *Gossiper) sendRumorPacket(content string) {
 func (gossiper *Gossiper) receiveRumorPacket(gossipPacket GossipPacket, addr *net.UDPAddr) {
 	id, origin, msg := gossipPacket.Rumor.ID, gossipPacket.Rumor.Origin, gossipPacket.Rumor.Text
 	senderAddr := addr.String()
+	rumor := gossipPacket.Rumor
+	if err := gossiper.verifyOrigin(origin, rumor.PublicKey, rumor.signedContent(), rumor.Signature); err != nil {
+		println("ERROR : rejecting rumor from " + senderAddr + " : " + err.Error())
+		return
+	}
+	gossiper.storeEncryptionKey(origin, rumor.EncryptionKey)
 
 	_, alreadyReceived := gossiper.Rumors.Load(fmt.Sprint(id) + "@" + origin)
 	nextID, known := gossiper.VectorClock.LoadOrStore(origin, uint32(1))
 	if alreadyReceived || (!known && id != uint32(1)) || (known && nextID.(uint32) != id) {
+		// A RUMOR WE ALREADY HAVE MAY STILL HAVE COME THROUGH A SHORTER PATH
+		gossiper.learnRouteFromRumor(rumor, addr)
 		return
 	}
 
+	// THE RUMOR WE STORE AND FORWARD IS ONE HOP FURTHER FROM ITS ORIGIN
+	relayedRumor := *rumor
+	relayedRumor.Hops = gossiper.rumorHops(rumor, addr) + 1
+	gossipPacket = GossipPacket{Rumor: &relayedRumor}
+
 	//UPDATING RUMORS LIST
-	gossiper.Rumors.Store(fmt.Sprint(id) + "@" + origin, GossipPacketTimed{ GossipPacket: gossipPacket, Timestamp: time.Now() })
+	gossiper.storeRumor(fmt.Sprint(id) + "@" + origin, GossipPacketTimed{ GossipPacket: gossipPacket, Timestamp: gossiper.Clock.Now() })
 
 	// UPDATING VECTOR CLOCK
-	gossiper.VectorClock.Store(origin, nextID.(uint32) + uint32(1))
+	gossiper.storeNextID(origin, nextID.(uint32) + uint32(1))
 
-	str := "RUMOR origin " + origin + " from " + senderAddr + " ID " +
-		fmt.Sprint(id) + " contents " + msg + gossiper.Peers.String()
-	gossiper.ToPrint <- str
+	gossiper.publish(RumorReceived{ Origin: origin, From: senderAddr, ID: id, Contents: msg, Peers: gossiper.peerList() })
 
 	// UPDATING DESTINATION-SEQUENCED DISTANCE VECTOR
-	knownAddr, exist := gossiper.DSDV.Load(origin)
-	if !exist || knownAddr.(*net.UDPAddr).String() != senderAddr && origin != gossiper.Name {
-		gossiper.DSDV.Store(origin, addr)
-		gossiper.ToPrint <- "DSDV " + origin + " " + senderAddr
-	}
+	gossiper.learnRouteFromRumor(rumor, addr)
+
+	// THE ORIGIN IS ALIVE, WE DELIVER THE MESSAGES WAITING FOR IT
+	gossiper.flushMailbox(origin)
 
 	// SENDING STATUS
-	gossiper.ToSend <- PacketToSend{Address: addr,
-		GossipPacket: &GossipPacket{Status: gossiper.constructStatuses()}}
+	gossiper.send(PacketToSend{Address: addr,
+		GossipPacket: &GossipPacket{Status: gossiper.constructStatuses()}})
 
 	// WE RUMORMONGER ONLY IF WE KNOW ONE OTHER PEER THAT SENT THE RUMOR
 	if gossiper.Peers.Size() > 1 {
 		gossiper.rumormonger(gossipPacket, gossiper.Peers.ChooseRandomPeerExcept(senderAddr))
 	}
-}
\ No newline at end of file
+}
+/*
+	learnRouteFromRumor updates the route towards the origin of a rumor received from the given address. If both the
+	origin and we use direct routes, the rumor carries the gossip address of its origin, that we add to our peers.
+	We only route directly to that address once it answered us, and keep the route through the relay until then
+ */
+func (gossiper *Gossiper) learnRouteFromRumor(rumor *RumorMessage, addr *net.UDPAddr) {
+	if gossiper.DirectRoutes && rumor.OriginAddr != "" && rumor.OriginAddr != gossiper.GossipAddr &&
+		util.IsValidAddress(rumor.OriginAddr) {
+		directAddr, err := net.ResolveUDPAddr(constants.UDP_VERSION, rumor.OriginAddr)
+		if !util.CheckAndPrintError(err) {
+			gossiper.Peers.AddBounded(directAddr.String(), constants.MAX_PEERS)
+			if gossiper.Peers.IsReachable(directAddr.String()) {
+				gossiper.updateRoute(rumor.Origin, directAddr, rumor.ID, 1, constants.ROUTE_FROM_DIRECT_RUMOR)
+				return
+			}
+			gossiper.probeDirectRoute(rumor.Origin, directAddr)
+		}
+	}
+	gossiper.updateRoute(rumor.Origin, addr, rumor.ID, gossiper.rumorHops(rumor, addr) + 1, constants.ROUTE_FROM_RUMOR)
+}
+
+/*
+	rumorHops returns the number of hops a rumor received from the given address claims to have done, bounded by
+	the hop limit. The hop count is not signed, so a relay could claim to be the origin of a rumor by sending it
+	with 0 hops : this claim is only believed if the rumor comes from the gossip address signed by its origin, or if
+	its origin advertises no address, in which case it cannot be checked. Any other count is trusted as it is
+ */
+func (gossiper *Gossiper) rumorHops(rumor *RumorMessage, addr *net.UDPAddr) uint32 {
+	hops := rumor.Hops
+	if hops > constants.DEFAULT_HOP_LIMIT {
+		hops = constants.DEFAULT_HOP_LIMIT
+	}
+	if hops == 0 && rumor.OriginAddr != "" {
+		originAddr, err := net.ResolveUDPAddr(constants.UDP_VERSION, rumor.OriginAddr)
+		if err != nil || originAddr.String() != addr.String() {
+			hops = 1
+		}
+	}
+	return hops
+}
+
+/*
+	probeDirectRoute sends a peer exchange to the gossip address advertised by the given origin, unless we are
+	already waiting for its answer. The answer makes us route directly to the origin
+ */
+func (gossiper *Gossiper) probeDirectRoute(origin string, directAddr *net.UDPAddr) {
+	now := gossiper.Clock.Now()
+	probe, exist := gossiper.DirectProbes.Load(directAddr.String())
+	if exist && now.Sub(probe.(DirectProbe).Sent) < constants.DIRECT_PROBE_TIMEOUT * time.Second {
+		return
+	}
+	gossiper.DirectProbes.Store(directAddr.String(), DirectProbe{ Origin: origin, Sent: now })
+	gossiper.sendPeerExchange(directAddr, false)
+}
+
+/*
+	confirmDirectRoute routes directly to the origin whose gossip address we probed, if the given address answered
+	one of our probes
+ */
+func (gossiper *Gossiper) confirmDirectRoute(addr *net.UDPAddr) {
+	probe, exist := gossiper.DirectProbes.Load(addr.String())
+	if !exist {
+		return
+	}
+	gossiper.DirectProbes.Delete(addr.String())
+	origin := probe.(DirectProbe).Origin
+	if entry, known := gossiper.DSDV.GetEntry(origin); known {
+		gossiper.updateRoute(origin, addr, entry.Seq, 1, constants.ROUTE_FROM_DIRECT_RUMOR)
+	}
+}
+
+/*
+	advertisedAddress returns the gossip address we put in our rumors, namely our address if we use direct routes
+	and the empty string otherwise
+ */
+func (gossiper *Gossiper) advertisedAddress() string {
+	if gossiper.DirectRoutes {
+		return gossiper.GossipAddr
+	}
+	return ""
+}
@@ -13,9 +13,9 @@ import (
 	are synced with the peer before flipping a coin
  */
 func (gossiper *Gossiper) rumormonger(gossipPacket GossipPacket, address *net.UDPAddr) {
-	gossiper.ToPrint <- "MONGERING with " + address.String()
+	gossiper.publish(MongeringStarted{ Peer: address.String() })
 
-	gossiper.ToSend <- PacketToSend{ Address: address, GossipPacket: &gossipPacket }
+	gossiper.send(PacketToSend{ Address: address, GossipPacket: &gossipPacket })
 	key := gossipPacket.Rumor.Origin + fmt.Sprint(gossipPacket.Rumor.ID) + address.String()
 	_, exist := gossiper.Acks.Load(key)
 	if exist {
@@ -24,7 +24,7 @@ func (gossiper *Gossiper) rumormonger(gossipPacket GossipPacket, address *net.UD
 	channel := make(chan GossipPacket)
 	gossiper.Acks.Store(key, channel)
 
-	ticker := time.NewTicker(time.Second)
+	ticker := gossiper.Clock.NewTicker(time.Second)
 	defer ticker.Stop()
 
 	select {
@@ -36,7 +36,13 @@ func (gossiper *Gossiper) rumormonger(gossipPacket GossipPacket, address *net.UD
 
 	case <-ticker.C:
 		gossiper.Acks.Delete(key)
+		if state, changed := gossiper.Peers.MarkMissedReply(address.String()); changed {
+			gossiper.publish(PeerStateChanged{ Address: address.String(), State: state })
+		}
 		gossiper.flipACoin(gossipPacket, address)
+
+	case <-gossiper.Done():
+		gossiper.Acks.Delete(key)
 	}
 }
 
@@ -46,9 +52,11 @@ func (gossiper *Gossiper) rumormonger(gossipPacket GossipPacket, address *net.UD
 func (gossiper *Gossiper) flipACoin(gossipPacket GossipPacket, oldAddr *net.UDPAddr){
 	if rand.Int() % 2 == 0 {
 		newAddr := gossiper.Peers.ChooseRandomPeerExcept(oldAddr.String())
+		if newAddr == nil { //THE OTHER PEERS MAY ALL BE DEAD
+			return
+		}
 
-		str := "FLIPPED COIN sending rumor to " + newAddr.String()
-		gossiper.ToPrint <- str
+		gossiper.publish(CoinFlipped{ Peer: newAddr.String() })
 		gossiper.rumormonger(gossipPacket, newAddr)
 	}
 }
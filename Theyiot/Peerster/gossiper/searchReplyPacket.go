@@ -2,7 +2,6 @@ package gossiper
 
 import (
 	"encoding/hex"
-	"fmt"
 	"github.com/Theyiot/Peerster/constants"
 	"github.com/Theyiot/Peerster/util"
 	"net"
@@ -13,11 +12,18 @@ import (
 	receiveSearchReply handles the packets of search reply type
  */
 func (gossiper *Gossiper) receiveSearchReply(gossipPacket GossipPacket, addr *net.UDPAddr) {
-	_, exist := gossiper.DSDV.LoadOrStore(gossipPacket.SearchReply.Origin, addr)
-	if !exist {
-		gossiper.ToPrint <- "DSDV " + gossipPacket.SearchReply.Origin + " " + addr.String()
+	searchReply := gossipPacket.SearchReply
+	err := gossiper.verifyOrigin(searchReply.Origin, searchReply.PublicKey, searchReply.signedContent(),
+		searchReply.Signature)
+	if err != nil {
+		println("ERROR : rejecting search reply from " + addr.String() + " : " + err.Error())
+		return
 	}
 
+	// A SEARCH REPLY HAS NO SEQUENCE NUMBER, IT ONLY TEACHES US UNKNOWN OR SHORTER ROUTES
+	hops := constants.DEFAULT_HOP_LIMIT - searchReply.HopLimit + 1
+	gossiper.updateRoute(searchReply.Origin, addr, 0, hops, constants.ROUTE_FROM_SEARCH_REPLY)
+
 	if gossipPacket.SearchReply.Destination != gossiper.Name {
 		gossiper.forwardSearchReplyPacket(gossipPacket)
 		return
@@ -25,31 +31,23 @@ func (gossiper *Gossiper) receiveSearchReply(gossipPacket GossipPacket, addr *ne
 
 	for _, result := range gossipPacket.SearchReply.Results {
 		peerName, hashHex := gossipPacket.SearchReply.Origin, hex.EncodeToString(result.MetafileHash)
-		str := "FOUND match " + result.FileName + " at " + peerName+ " metafile=" + hashHex + " chunks="
-		for i := 0 ; i < len(result.ChunkMap) ; i++ {
-			str += fmt.Sprint(result.ChunkMap[i])
-			if i < len(result.ChunkMap) - 1 {
-				str += ","
-			}
-		}
-		gossiper.ToPrint <- str
+		gossiper.publish(SearchMatched{ FileName: result.FileName, Origin: peerName, MetaHash: hashHex,
+			Chunks: result.ChunkMap })
 
-		searchFileChunksNotCasted, _ := gossiper.SearchedFiles.LoadOrStore(hashHex, make([]SearchedFileChunk, 0))
-		searchFileChunks := searchFileChunksNotCasted.([]SearchedFileChunk)
+		searchFileChunksNotCasted, _ := gossiper.SearchedFiles.LoadOrStore(hashHex, make([]*SearchedFileChunk, 0))
+		searchFileChunks := searchFileChunksNotCasted.([]*SearchedFileChunk)
 		for _, id := range result.ChunkMap {
 			exist := false
 			for _, searchFileChunk := range searchFileChunks {
 				if id == searchFileChunk.ChunkID {
-					searchFileChunk.lock.Lock()
-					searchFileChunk.owningPeers = append(searchFileChunk.owningPeers, peerName)
-					searchFileChunk.lock.Unlock()
+					searchFileChunk.addOwner(peerName)
 					exist = true
 				}
 			}
 			if !exist {
 				searchFileChunk := SearchedFileChunk{owningPeers:[]string {peerName}, ChunkID:id,
 					ChunkCount:result.ChunkCount, FileName:result.FileName}
-				searchFileChunks = append(searchFileChunks, searchFileChunk)
+				searchFileChunks = append(searchFileChunks, &searchFileChunk)
 				if uint64(len(searchFileChunks)) == result.ChunkCount {
 					gossiper.findFullMatches(result.FileName)
 				}
@@ -69,14 +67,14 @@ func (gossiper *Gossiper) forwardSearchReplyPacket(gossipPacket GossipPacket) {
 		return
 	}
 
-	nextHopAddr, exist := gossiper.DSDV.Load(gossipPacket.SearchReply.Destination)
+	nextHopAddr, exist := gossiper.DSDV.GetNextHop(gossipPacket.SearchReply.Destination)
 	if !exist {
 		println("ERROR : don't know how to forward to " + gossipPacket.SearchReply.Destination)
 		return
 	}
 
-	packetToSend := PacketToSend{Address: nextHopAddr.(*net.UDPAddr), GossipPacket: &gossipPacket}
-	gossiper.ToSend <- packetToSend
+	packetToSend := PacketToSend{Address: nextHopAddr, GossipPacket: &gossipPacket}
+	gossiper.send(packetToSend)
 }
 
 /*
@@ -94,14 +92,42 @@ func (gossiper *Gossiper) findFullMatches(fileName string) {
 				if util.CheckAndPrintError(err) {
 					return
 				} else if fullMatches == constants.DEFAULT_FULL_MATCHES {
-					gossiper.ToPrint <- "SEARCH FINISHED"
+					gossiper.publish(SearchFinished{ Keywords: keywords[i] })
 					gossiper.ActiveSearches.Remove(i)
 					channel, exist := gossiper.FinishedSearches.Load(strings.Join(keywords[i], ","))
 					if exist {
-						channel.(chan Signal) <- Signal{}
+						select {
+						case channel.(chan Signal) <- Signal{}:
+						case <- gossiper.Done():
+						}
 					}
 				}
 			}
 		}
 	}
-}
\ No newline at end of file
+}
+
+/*
+	addOwner adds a peer to the peers that own the chunk, if it was not already known
+ */
+func (searchedFileChunk *SearchedFileChunk) addOwner(peerName string) {
+	searchedFileChunk.lock.Lock()
+	defer searchedFileChunk.lock.Unlock()
+	for _, owner := range searchedFileChunk.owningPeers {
+		if owner == peerName {
+			return
+		}
+	}
+	searchedFileChunk.owningPeers = append(searchedFileChunk.owningPeers, peerName)
+}
+
+/*
+	getOwners returns a copy of the peers that own the chunk
+ */
+func (searchedFileChunk *SearchedFileChunk) getOwners() []string {
+	searchedFileChunk.lock.RLock()
+	defer searchedFileChunk.lock.RUnlock()
+	owners := make([]string, len(searchedFileChunk.owningPeers))
+	copy(owners, searchedFileChunk.owningPeers)
+	return owners
+}
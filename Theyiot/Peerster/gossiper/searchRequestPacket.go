@@ -1,7 +1,6 @@
 package gossiper
 
 import (
-	"crypto/sha256"
 	"encoding/hex"
 	"github.com/Theyiot/Peerster/constants"
 	"github.com/Theyiot/Peerster/util"
@@ -28,13 +27,17 @@ func (gossiper *Gossiper) sendSearchRequest(keywords []string, budget uint64) {
 	}
 	for budget <= constants.MAX_BUDGET {
 		gossiper.sendSearchPacket(budget, gossiper.Name, keywords, gossiper.Peers.GetAddresses())
-		timer := time.NewTicker(time.Second)
+		timer := gossiper.Clock.NewTimer(time.Second)
 		select {
 		case <- timer.C:
 			budget *= 2
 		case <- finishedChannel:
+			timer.Stop()
 			gossiper.FinishedSearches.Delete(keywordsString)
 			return
+		case <- gossiper.Done():
+			timer.Stop()
+			return
 		}
 	}
 }
@@ -50,18 +53,12 @@ func (gossiper *Gossiper) receiveSearchRequest(gossipPacket GossipPacket, addr *
 		return
 	}
 
-	go func() {
-		timer := time.NewTicker(time.Second / 2)
-		select {
-		case <- timer.C:
-			gossiper.SearchRequests.Delete(key)
-		}
-	}()
+	gossiper.Clock.AfterFunc(time.Second / 2, func() {
+		gossiper.SearchRequests.Delete(key)
+	})
 
-	_, exist = gossiper.DSDV.LoadOrStore(origin, addr)
-	if !exist {
-		gossiper.ToPrint <- "DSDV " + origin + " " + addr.String()
-	}
+	// A SEARCH REQUEST HAS NEITHER SEQUENCE NUMBER NOR HOP COUNT, IT ONLY TEACHES US UNKNOWN ROUTES
+	gossiper.updateRoute(origin, addr, 0, constants.DEFAULT_HOP_LIMIT, constants.ROUTE_FROM_SEARCH_REQUEST)
 
 	results := make([]*SearchResult, 0)
 	for _, keyword := range request.Keywords {
@@ -69,9 +66,12 @@ func (gossiper *Gossiper) receiveSearchRequest(gossipPacket GossipPacket, addr *
 			chunkMap := make([]uint64, 0)
 			file := indexedFile.(IndexedFile)
 			if strings.Contains(file.FileName, keyword) {
-				for i := 0 ; i < len(file.MetaFile) / sha256.Size ; i++ {
-					index := i * sha256.Size
-					hashHex := hex.EncodeToString(file.MetaFile[index:index + sha256.Size])
+				hashes, success := resolveMetaFile(file.MetaFile, readVerifiedChunk)
+				if !success {
+					return true
+				}
+				for i, chunkHash := range hashes {
+					hashHex := hex.EncodeToString(chunkHash)
 					if _, err := os.Stat(constants.PATH_FILE_CHUNKS + hashHex); !os.IsNotExist(err) {
 						chunkMap = append(chunkMap, uint64(i + 1))
 					}
@@ -81,7 +81,7 @@ func (gossiper *Gossiper) receiveSearchRequest(gossipPacket GossipPacket, addr *
 					return false
 				}
 				result := SearchResult{FileName:file.FileName, MetafileHash:metaHash,
-					ChunkCount:uint64(len(file.MetaFile) / sha256.Size), ChunkMap:chunkMap}
+					ChunkCount:uint64(len(hashes)), ChunkMap:chunkMap}
 				results = append(results, &result)
 			}
 			return true
@@ -91,8 +91,9 @@ func (gossiper *Gossiper) receiveSearchRequest(gossipPacket GossipPacket, addr *
 	if len(results) > 0 {
 		searchReply := SearchReply{Origin:gossiper.Name, Destination:origin, HopLimit:constants.DEFAULT_HOP_LIMIT,
 			Results:results}
+		gossiper.signSearchReply(&searchReply)
 		packetToSend := PacketToSend{GossipPacket:&GossipPacket{SearchReply:&searchReply}, Address:addr}
-		gossiper.ToSend <- packetToSend
+		gossiper.send(packetToSend)
 	}
 
 	//if budget is 1, then decreasing it will be 0 and we forward to 0 peer
@@ -132,7 +133,7 @@ func (gossiper *Gossiper) sendSearchPacket(budget uint64, origin string, keyword
 		}
 		requestPacket := SearchRequest{Budget:dividend, Origin:origin, Keywords:keywords}
 		packetToSend := PacketToSend{GossipPacket:&GossipPacket{SearchRequest:&requestPacket}, Address:addresses[index]}
-		gossiper.ToSend <- packetToSend
+		gossiper.send(packetToSend)
 	}
 }
 
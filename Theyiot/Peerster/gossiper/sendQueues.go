@@ -0,0 +1,275 @@
+package gossiper
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Theyiot/Peerster/constants"
+	"github.com/Theyiot/Peerster/util"
+	"github.com/dedis/protobuf"
+	"math/rand"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+	SendQueues holds one bounded queue per peer and per priority for the packets we send. Each peer has its own
+	goroutine sending its packets, so a slow or saturated peer does not delay the packets for the others. A queue
+	that stays empty for a while is removed with its goroutine, and there are at most constants.MAX_SEND_QUEUES
+	queues at once
+ */
+type SendQueues struct {
+	queues			map[string]*peerQueue
+	capacity		int
+	peerRate		uint
+	globalLimiter	*util.RateLimiter
+	clock			util.Clock
+	fragmentID		uint64
+	lock			sync.Mutex
+}
+
+/*
+	A peerQueue holds the packets waiting to be sent to one peer, from the most to the least urgent priority, and
+	counts the packets that were sent and dropped. Users is the number of packets being queued, during which the
+	queue can not be removed
+ */
+type peerQueue struct {
+	address			*net.UDPAddr
+	packets			[constants.SEND_PRIORITIES]chan *GossipPacket
+	ready			chan Signal
+	limiter			*util.RateLimiter
+	users			int
+	sent			uint64
+	dropped			uint64
+}
+
+/*
+	send queues the packet for its destination. Best-effort packets are dropped when the queue of the destination is
+	full, the other ones wait until there is room for them or the gossiper is stopped. The packet is dropped if the
+	destination has no queue and no queue can be created
+ */
+func (gossiper *Gossiper) send(packet PacketToSend) {
+	queue := gossiper.SendQueues.getQueue(packet.Address, func(queue *peerQueue) {
+		gossiper.spawn(func() { gossiper.sendQueuedPackets(queue) })
+	})
+	if queue == nil {
+		println("ERROR : too many send queues, dropping a packet for " + packet.Address.String())
+		return
+	}
+	defer gossiper.SendQueues.release(queue)
+	priority := sendPriority(packet.GossipPacket)
+	if priority == constants.SEND_PRIORITY_BEST_EFFORT {
+		select {
+		case queue.packets[priority] <- packet.GossipPacket:
+		default:
+			atomic.AddUint64(&queue.dropped, 1)
+			return
+		}
+	} else {
+		select {
+		case queue.packets[priority] <- packet.GossipPacket:
+		case <-gossiper.Done():
+			return
+		}
+	}
+
+	select {
+	case queue.ready <- Signal{}:
+	default:
+	}
+}
+
+/*
+	sendQueuedPackets sends the packets of the queue of a peer, always the most urgent first, while respecting the
+	rate limit of the peer and the global one. A packet that does not fit in a single datagram is sent as fragments.
+	It returns once the gossiper is stopped, or once the queue is removed because it stayed empty for
+	constants.SEND_QUEUE_IDLE_TIMEOUT seconds
+ */
+func (gossiper *Gossiper) sendQueuedPackets(queue *peerQueue) {
+	for {
+		idle := gossiper.Clock.NewTimer(constants.SEND_QUEUE_IDLE_TIMEOUT * time.Second)
+		gossipPacket := queue.next(gossiper.Done(), idle.C)
+		idle.Stop()
+		if gossipPacket == nil {
+			select {
+			case <-gossiper.Done():
+				return
+			default:
+			}
+			if gossiper.SendQueues.removeIfIdle(queue) {
+				return
+			}
+			continue
+		}
+		bytes, err := protobuf.Encode(gossipPacket)
+		if util.CheckAndPrintError(err) {
+			continue
+		}
+
+		datagrams := [][]byte{bytes}
+		if len(bytes) > constants.MAX_DATAGRAM_SIZE {
+			datagrams, err = gossiper.SendQueues.fragment(bytes)
+			if util.CheckAndPrintError(err) {
+				atomic.AddUint64(&queue.dropped, 1)
+				continue
+			}
+		}
+		for _, datagram := range datagrams {
+			// THE PACKET IS DROPPED IF WE ARE STOPPED WHILE WAITING FOR THE RATE LIMITS
+			if queue.limiter.Wait(gossiper.Done()) != nil || gossiper.SendQueues.globalLimiter.Wait(gossiper.Done()) != nil {
+				return
+			}
+			err = gossiper.GossipServer.Send(datagram, queue.address)
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			util.CheckAndPrintError(err)
+		}
+		atomic.AddUint64(&queue.sent, 1)
+	}
+}
+
+/*
+	fragment splits an encoded packet into encoded Fragment packets that each fit in a single datagram
+ */
+func (queues *SendQueues) fragment(bytes []byte) ([][]byte, error) {
+	if len(bytes) > constants.MAX_REASSEMBLED_SIZE {
+		return nil, errors.New("a packet of " + fmt.Sprint(len(bytes)) + " bytes is too big to be sent")
+	}
+	id := atomic.AddUint64(&queues.fragmentID, 1)
+	fragments := util.SplitIntoFragments(bytes)
+	datagrams := make([][]byte, len(fragments))
+	for index, data := range fragments {
+		fragment := Fragment{ID: id, Index: uint32(index), Count: uint32(len(fragments)), Data: data}
+		datagram, err := protobuf.Encode(&GossipPacket{Fragment: &fragment})
+		if err != nil {
+			return nil, err
+		}
+		datagrams[index] = datagram
+	}
+	return datagrams, nil
+}
+
+/*
+	next waits for a packet to be queued and returns the most urgent one, or nil if done is closed or idle fires
+	first
+ */
+func (queue *peerQueue) next(done <-chan struct{}, idle <-chan time.Time) *GossipPacket {
+	for {
+		for _, packets := range queue.packets {
+			select {
+			case gossipPacket := <-packets:
+				return gossipPacket
+			default:
+			}
+		}
+		select {
+		case <-queue.ready:
+		case <-done:
+			return nil
+		case <-idle:
+			return nil
+		}
+	}
+}
+
+/*
+	getQueue returns the queue of the given peer, creating it and starting its sending routine if needed. It
+	returns nil if the queue does not exist and there are already constants.MAX_SEND_QUEUES queues. The queue can
+	not be removed until release is called
+ */
+func (queues *SendQueues) getQueue(address *net.UDPAddr, sendPackets func(*peerQueue)) *peerQueue {
+	queues.lock.Lock()
+	defer queues.lock.Unlock()
+	queue, exist := queues.queues[address.String()]
+	if !exist {
+		if len(queues.queues) >= constants.MAX_SEND_QUEUES {
+			return nil
+		}
+		queue = &peerQueue{ address: address, ready: make(chan Signal, 1),
+			limiter: util.CreateRateLimiter(queues.peerRate, queues.clock) }
+		for priority := range queue.packets {
+			queue.packets[priority] = make(chan *GossipPacket, queues.capacity)
+		}
+		queues.queues[address.String()] = queue
+		sendPackets(queue)
+	}
+	queue.users++
+	return queue
+}
+
+/*
+	release tells that the packet for which getQueue returned the queue was queued, or dropped
+ */
+func (queues *SendQueues) release(queue *peerQueue) {
+	queues.lock.Lock()
+	defer queues.lock.Unlock()
+	queue.users--
+}
+
+/*
+	removeIfIdle removes the queue if it is empty and no packet is being queued, and returns whether it was removed
+ */
+func (queues *SendQueues) removeIfIdle(queue *peerQueue) bool {
+	queues.lock.Lock()
+	defer queues.lock.Unlock()
+	if queue.users > 0 {
+		return false
+	}
+	for _, packets := range queue.packets {
+		if len(packets) > 0 {
+			return false
+		}
+	}
+	delete(queues.queues, queue.address.String())
+	return true
+}
+
+/*
+	getStatistics returns, for every peer we sent packets to, the number of packets waiting in its queue, sent and
+	dropped, sorted by address
+ */
+func (queues *SendQueues) getStatistics() []SendQueueJSON {
+	queues.lock.Lock()
+	statistics := make([]SendQueueJSON, 0, len(queues.queues))
+	for _, queue := range queues.queues {
+		queued := 0
+		for _, packets := range queue.packets {
+			queued += len(packets)
+		}
+		statistics = append(statistics, SendQueueJSON{Address: queue.address.String(), Queued: queued,
+			Sent: atomic.LoadUint64(&queue.sent), Dropped: atomic.LoadUint64(&queue.dropped)})
+	}
+	queues.lock.Unlock()
+	sort.Slice(statistics, func(i, j int) bool {
+		return statistics[i].Address < statistics[j].Address
+	})
+	return statistics
+}
+
+/*
+	sendPriority returns the priority of a packet. Statuses and acknowledgements are the most urgent, since other
+	peers wait for them, while data replies and searches are best-effort, since they are requested again when lost
+ */
+func sendPriority(gossipPacket *GossipPacket) int {
+	switch {
+	case gossipPacket.Status != nil, gossipPacket.PrivateAck != nil, gossipPacket.BlockRequest != nil:
+		return constants.SEND_PRIORITY_CONTROL
+	case gossipPacket.DataReply != nil, gossipPacket.SearchRequest != nil, gossipPacket.SearchReply != nil:
+		return constants.SEND_PRIORITY_BEST_EFFORT
+	default:
+		return constants.SEND_PRIORITY_NORMAL
+	}
+}
+
+/*
+	createSendQueues creates the SendQueues, with capacity packets per peer and per priority, rate limited to
+	peerRate packets per second per peer and globalRate packets per second in total (0 for no limit), measured
+	with the clock
+ */
+func createSendQueues(capacity, peerRate, globalRate uint, clock util.Clock) *SendQueues {
+	return &SendQueues{ queues: make(map[string]*peerQueue), capacity: int(capacity), peerRate: peerRate,
+		globalLimiter: util.CreateRateLimiter(globalRate, clock), clock: clock, fragmentID: rand.Uint64() }
+}
@@ -7,9 +7,8 @@ func (gossiper *Gossiper) receiveSimplePacket(gossipPacket GossipPacket) {
 	origin := gossipPacket.Simple.OriginalName
 	relayAddr := gossipPacket.Simple.RelayPeerAddr
 	content := gossipPacket.Simple.Contents
-	str := "SIMPLE MESSAGE origin " + origin + " from " + relayAddr + " contents " + content +
-		gossiper.Peers.String()
-	gossiper.ToPrint <- str
+	gossiper.publish(SimpleMessageReceived{ Origin: origin, RelayAddr: relayAddr, Contents: content,
+		Peers: gossiper.peerList() })
 
 	gossipPacket.Simple.RelayPeerAddr = gossiper.GossipAddr
 
@@ -21,8 +20,7 @@ func (gossiper *Gossiper) receiveSimplePacket(gossipPacket GossipPacket) {
 	sendSimplePacket takes care of sending a simple message to all known peers
  */
 func (gossiper *Gossiper) sendSimplePacket(content string) {
-	str := "CLIENT MESSAGE " + content + gossiper.Peers.String()
-	gossiper.ToPrint <- str
+	gossiper.publish(ClientMessageReceived{ Contents: content, Peers: gossiper.peerList() })
 	simpleMessage := SimpleMessage{Contents: content, RelayPeerAddr: gossiper.GossipAddr, OriginalName: gossiper.Name}
 	gossipPacket := GossipPacket{Simple: &simpleMessage}
 	gossipPacket.Simple.OriginalName = gossiper.Name
@@ -9,12 +9,12 @@ import (
 	receiveStatusPacket handles the packets of status type
  */
 func (gossiper *Gossiper) receiveStatusPacket(statusPacket GossipPacket, addr *net.UDPAddr) {
-	str := "STATUS from " + addr.String()
+	received := make([]PeerStatus, 0)
 	for _, status := range statusPacket.Status.Want {
 		identifier, statusNextID := status.Identifier, status.NextID
 
 		if status.NextID > 1 {
-			str += " peer " + identifier + " nextID " + fmt.Sprint(statusNextID)
+			received = append(received, status)
 
 			if channel, exist := gossiper.Acks.Load(identifier + fmt.Sprint(statusNextID - 1) + addr.String()); exist {
 				select { // NON-BLOCKING SEND
@@ -27,7 +27,6 @@ func (gossiper *Gossiper) receiveStatusPacket(statusPacket GossipPacket, addr *n
 	}
 
 	if gossiper.syncPeers(statusPacket, addr) {
-		str += gossiper.Peers.String() + "\nIN SYNC WITH " + addr.String()
-		gossiper.ToPrint <- str
+		gossiper.publish(InSyncWithPeer{ From: addr.String(), Status: received, Peers: gossiper.peerList() })
 	}
 }
\ No newline at end of file
@@ -1,10 +1,12 @@
 package gossiper
 
 import (
+	"context"
 	"crypto/sha256"
 	"github.com/Theyiot/Peerster/constants"
 	"github.com/Theyiot/Peerster/util"
 	"net"
+	"net/http"
 	"sync"
 	"time"
 )
@@ -17,17 +19,27 @@ type SimpleMessage struct {
 }
 
 type RumorMessage struct {
-	Origin	string
-	ID		uint32
-	Text	string
+	Origin			string
+	ID				uint32
+	Text			string
+	Hops			uint32
+	OriginAddr		string
+	PublicKey		[]byte
+	EncryptionKey	[]byte
+	Signature		[]byte
 }
 
 type PrivateMessage struct {
-	Origin      string
-	ID          uint32
-	Text        string
-	Destination string
-	HopLimit    uint32
+	Origin        string
+	ID            uint32
+	Text          string
+	Destination   string
+	HopLimit      uint32
+	EncryptedText []byte
+	EphemeralKey  []byte
+	Nonce         []byte
+	PublicKey     []byte
+	Signature     []byte
 }
 
 type FileIndexMessage struct {
@@ -40,6 +52,30 @@ type FileRequestMessage struct {
 	Request     string
 }
 
+type FileNameRequestMessage struct {
+	FileName	string
+}
+
+type Fragment struct {
+	ID			uint64
+	Index		uint32
+	Count		uint32
+	Data		[]byte
+}
+
+type PeerExchange struct {
+	Peers		[]string
+	IsReply		bool
+}
+
+type RoutesRequestMessage struct {
+	Destination	string
+}
+
+type RoutesReply struct {
+	Routes		[]RouteJSON
+}
+
 type SearchRequestMessage struct {
 	Keywords 	[]string
 	Budget		uint64
@@ -55,6 +91,19 @@ type PeerStatus struct {
 	NextID		uint32
 }
 
+type PrivateAck struct {
+	Origin			string
+	Destination		string
+	ID				uint32
+	HopLimit		uint32
+	PublicKey		[]byte
+	Signature		[]byte
+}
+
+type MailboxDeposit struct {
+	Private			PrivateMessage
+}
+
 type DataRequest struct {
 	Origin			string
 	Destination		string
@@ -68,6 +117,8 @@ type DataReply struct {
 	HopLimit		uint32
 	HashValue		[]byte
 	Data			[]byte
+	PublicKey		[]byte
+	Signature		[]byte
 }
 
 type SearchRequest struct {
@@ -81,6 +132,8 @@ type SearchReply struct {
 	Destination 	string
 	HopLimit 		uint32
 	Results			[]*SearchResult
+	PublicKey		[]byte
+	Signature		[]byte
 }
 
 type SearchResult struct {
@@ -99,6 +152,7 @@ type RumorMessageTimed struct {
 type PrivateMessageTimed struct {
 	Private			PrivateMessage
 	Timestamp		time.Time
+	Status			string
 }
 
 type GossipPacketTimed struct {
@@ -112,12 +166,18 @@ type GossipPacket struct {
 	Rumor			*RumorMessage
 	Status			*StatusPacket
 	Private			*PrivateMessage
+	PrivateAck		*PrivateAck
+	MailboxDeposit	*MailboxDeposit
+	PeerExchange	*PeerExchange
 	DataRequest		*DataRequest
 	DataReply		*DataReply
 	SearchRequest	*SearchRequest
 	SearchReply		*SearchReply
 	TxPublish		*TxPublish
 	BlockPublish	*BlockPublish
+	BlockRequest	*BlockRequest
+	BlockReply		*BlockReply
+	Fragment		*Fragment
 }
 
 type ClientPacket struct {
@@ -126,6 +186,8 @@ type ClientPacket struct {
 	FileRequest       *FileRequestMessage
 	FileIndex         *FileIndexMessage
 	FileSearchRequest *SearchRequestMessage
+	FileNameRequest   *FileNameRequestMessage
+	RoutesRequest     *RoutesRequestMessage
 }
 
 //FILES
@@ -164,39 +226,80 @@ type BlockPublish struct {
 	HopLimit	uint32
 }
 
+type BlockRequest struct {
+	HashValue	[]byte
+}
+
+type BlockReply struct {
+	Block		Block
+}
+
 type Block struct {
 	PrevHash		[sha256.Size]byte
 	Nonce			[constants.NOUNCE_SIZE]byte
+	Timestamp		int64
+	Difficulty		uint32
 	Transactions	[]TxPublish
 }
 
 //OTHERS
 type Gossiper struct {
-	UIServer       		*net.UDPConn
+	Config				Config
+	UIServer       		util.Transport
 	GossipAddr     		string
-	GossipServer   		*net.UDPConn
+	GossipServer   		util.Transport
 	Name           		string
 	Simple         		bool
+	DownloadWindow		uint
+	MailboxReplicas		uint
+	DirectRoutes		bool
 	CurrentBlock		*util.CurrentBlockHash
 	Transactions		*TransactionsSet
+	OrphanBlocks		*OrphanBlocksSet
+	Consensus			ConsensusParams
+	Identity			*Identity
 	Peers          		*util.AddrSet
 	ActiveSearches		*util.FullMatchesSet
 	NameToMetaHash		sync.Map //Map[name]MetaHash
+	PublicKeys			sync.Map //Map[origin]ed25519.PublicKey
+	EncryptionKeys		sync.Map //Map[origin]X25519 public key ([]byte)
 	VectorClock    		sync.Map //Map[origin]id
 	Rumors         		sync.Map //Map[id@origin]GossipPacket	(only rumors)
 	Privates       		sync.Map //Map[origin]GossipPacket		(only privates)
-	DSDV           		sync.Map //Map[origin]*net.UDPAddr
+	PrivateIDs			sync.Map //Map[destination]id			(last ID sent)
+	PrivateStatuses		sync.Map //Map[id@destination]status	(only our privates)
+	PrivateAcks			sync.Map //Map[id@destination]chan(Signal)
+	ReceivedPrivates	sync.Map //Map[id@origin]Signal
+	Mailbox				sync.Map //Map[destination][]PrivateMessage	(not acknowledged yet)
+	PrivatesLock		sync.Mutex
+	DSDV           		*util.RoutingTable
+	DirectProbes		sync.Map //Map[gossipAddr]DirectProbe	(direct routes waiting for a reply)
+	RouteExpiry			uint
 	IndexedFiles      	sync.Map //Map[metaHash(string)]IndexedFile
 	ReceivingFile     	sync.Map //Map[net.UDPAddr]chan([]byte)
-	SearchedFiles     	sync.Map //Map[metahash]SearchedFileChunk
+	SearchedFiles     	sync.Map //Map[metahash][]*SearchedFileChunk
+	Downloads         	sync.Map //Map[metahash]Signal			(downloads in progress)
 	Acks              	sync.Map //Map[origin + id + address]chan(statusPacket)
 	SearchRequests    	sync.Map //Map[origin + keyword]SearchRequests
 	FinishedSearches  	sync.Map //Map[keywords]chan(Signal)
 	Blockchain        	sync.Map //Map[blockHash]block
-	ToPrint          	chan string
-	ToSend            	chan PacketToSend
+	BlockRequests     	sync.Map //Map[blockHash]time.Time	(blocks requested to other peers)
+	BlockInfos        	sync.Map //Map[blockHash]BlockInfo
+	Storage           	*util.KeyValueLog
+	Events				*EventBus
+	Clock				util.Clock
+	SendQueues			*SendQueues
+	Reassembler			*util.Reassembler
 	ToAddToBlockchain 	chan Block
-	BlockMined        	chan Signal
+	MiningRefresh     	chan Signal
+	ctx					context.Context
+	cancel				context.CancelFunc
+	routines			sync.WaitGroup		//routines Stop waits for
+	routinesLock		sync.Mutex
+	stopOnce			sync.Once
+	done				chan struct{}		//closed once the gossiper is stopped
+	doneOnce			sync.Once
+	webServer			*http.Server
 }
 
 // WEB STRUCTS
@@ -215,6 +318,30 @@ type FileRequestJSON struct {
 	Dest		string
 }
 
+type PeerJSON struct {
+	Address			string
+	State			string
+	LastReceived	string
+	MissedReplies	uint
+}
+
+type SendQueueJSON struct {
+	Address			string
+	Queued			int
+	Sent			uint64
+	Dropped			uint64
+}
+
+type RouteJSON struct {
+	Destination		string
+	NextHop			string
+	Seq				uint32
+	Hops			uint32
+	Age				int64
+	Updated			string
+	LearnedFrom		string
+}
+
 type WebServerID  struct {
 	Name		string
 	Address		string
@@ -226,6 +353,20 @@ type PacketToSend struct {
 	Address      *net.UDPAddr
 }
 
+/*
+	A DirectProbe is a peer exchange sent to the gossip address advertised by an origin, to make sure that we can
+	reach the origin directly before routing to it
+ */
+type DirectProbe struct {
+	Origin		string
+	Sent		time.Time
+}
+
+type CurrentBlockState struct {
+	HashHex		string
+	Depth		uint64
+}
+
 type CurrentBlock struct {
 	HashHex		string
 	lock		sync.RWMutex
@@ -78,7 +78,7 @@ func (gossiper *Gossiper) syncMeWithPeer(statusPacket GossipPacket, peerAddr *ne
 		statusNextID := status.NextID
 		myNextID, peerKnown := gossiper.VectorClock.Load(status.Identifier)
 		if !peerKnown || statusNextID > myNextID.(uint32) {
-			gossiper.ToSend <- PacketToSend{ Address: peerAddr, GossipPacket: &GossipPacket{ Status: gossiper.constructStatuses() } }
+			gossiper.send(PacketToSend{ Address: peerAddr, GossipPacket: &GossipPacket{ Status: gossiper.constructStatuses() } })
 			return false
 		}
 	}
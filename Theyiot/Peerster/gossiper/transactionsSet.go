@@ -9,9 +9,11 @@ type TransactionsSet struct {
 	lock			sync.RWMutex
 }
 
+/*
+	contains checks whether a transaction for the same name is already in the set. The lock must be held by
+	the caller
+ */
 func (set *TransactionsSet) contains(newTransaction *TxPublish) bool {
-	set.lock.RLock()
-	defer set.lock.RUnlock()
 	for _, transaction := range set.transactions {
 		if transaction.File.Name == newTransaction.File.Name {
 			return true
@@ -20,14 +22,22 @@ func (set *TransactionsSet) contains(newTransaction *TxPublish) bool {
 	return false
 }
 
-func (set *TransactionsSet) Add(newTransaction *TxPublish) {
+/*
+	Add adds a transaction to the set, and returns false if a transaction for the same name was already there
+ */
+func (set *TransactionsSet) Add(newTransaction *TxPublish) bool {
 	set.lock.Lock()
 	defer set.lock.Unlock()
-	if !set.contains(newTransaction) {
-		set.transactions = append(set.transactions, newTransaction)
+	if set.contains(newTransaction) {
+		return false
 	}
+	set.transactions = append(set.transactions, newTransaction)
+	return true
 }
 
+/*
+	flushFromBlock removes from the set the transactions whose name is claimed by the given block
+ */
 func (set *TransactionsSet) flushFromBlock(block Block) {
 	newTransactions := make([]*TxPublish, 0)
 	set.lock.Lock()
@@ -43,16 +53,20 @@ func (set *TransactionsSet) flushFromBlock(block Block) {
 			newTransactions = append(newTransactions, transaction)
 		}
 	}
+	set.transactions = newTransactions
 }
 
+/*
+	getSetCopy returns a copy of the transactions of the set, in the order they were added
+ */
 func (set *TransactionsSet) getSetCopy() []*TxPublish {
-	var transactionsCopy []*TxPublish
 	set.lock.RLock()
 	defer set.lock.RUnlock()
+	transactionsCopy := make([]*TxPublish, len(set.transactions))
 	copy(transactionsCopy, set.transactions)
 	return transactionsCopy
 }
 
 func createTransactionsSet() *TransactionsSet {
 	return &TransactionsSet{ transactions:make([]*TxPublish, 0) }
-}
\ No newline at end of file
+}
@@ -10,6 +10,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
 /*
@@ -40,13 +41,38 @@ func (gossiper *Gossiper) getRumorsAsList() []RumorMessageTimed {
 	getPeersNameAsList returns a list of all the known peers name
  */
 func (gossiper *Gossiper) getPeersNameAsList() []string {
-	names := make([]string, 0)
-	gossiper.DSDV.Range(func(origin, address interface{}) bool {
-		names = append(names, origin.(string))
-		return true
-	})
-	sort.Strings(names)
-	return names
+	return gossiper.DSDV.GetDestinations()
+}
+
+/*
+	getPeersAsList returns the address of every peer, with its state, the last time we received a packet from it
+	(empty if we never did) and the number of status replies it missed in a row
+ */
+func (gossiper *Gossiper) getPeersAsList() []PeerJSON {
+	peers := make([]PeerJSON, 0)
+	for _, liveness := range gossiper.Peers.GetLiveness() {
+		lastReceived := ""
+		if !liveness.LastReceived.IsZero() {
+			lastReceived = liveness.LastReceived.Format(time.RFC3339)
+		}
+		peers = append(peers, PeerJSON{Address: liveness.Address, State: liveness.State,
+			LastReceived: lastReceived, MissedReplies: liveness.MissedReplies})
+	}
+	return peers
+}
+
+/*
+	getRoutesAsList returns the routing table, namely the next hop, sequence number, hop count, age in seconds, last
+	update and type of the packet that taught us the route towards every known peer
+ */
+func (gossiper *Gossiper) getRoutesAsList() []RouteJSON {
+	routes := make([]RouteJSON, 0)
+	for _, entry := range gossiper.DSDV.GetEntries() {
+		routes = append(routes, RouteJSON{Destination: entry.Destination, NextHop: entry.NextHop.String(),
+			Seq: entry.Seq, Hops: entry.Hops, Age: int64(gossiper.Clock.Now().Sub(entry.Updated).Seconds()),
+			Updated: entry.Updated.Format(time.RFC3339), LearnedFrom: entry.LearnedFrom})
+	}
+	return routes
 }
 
 /*
@@ -54,15 +80,19 @@ func (gossiper *Gossiper) getPeersNameAsList() []string {
  */
 func (gossiper *Gossiper) getPrivateMessagesAsMap() map[string][]PrivateMessageTimed {
 	privates := make(map[string][]PrivateMessageTimed, 0)
-	gossiper.DSDV.Range(func(origin, _ interface{}) bool {
-		privates[origin.(string)] = make([]PrivateMessageTimed, 0)
-		return true
-	})
+	for _, destination := range gossiper.DSDV.GetDestinations() {
+		privates[destination] = make([]PrivateMessageTimed, 0)
+	}
 	gossiper.Privates.Range(func(origin, packets interface{}) bool {
 		msgListForOrigin := privates[origin.(string)]
 		for _, packet := range packets.([]GossipPacketTimed) {
-			msgListForOrigin = append(msgListForOrigin, PrivateMessageTimed{Private: *packet.GossipPacket.Private,
-				Timestamp: packet.Timestamp})
+			private := *packet.GossipPacket.Private
+			status, _ := gossiper.PrivateStatuses.Load(privateMessageKey(private.Destination, private.ID))
+			if private.Origin != gossiper.Name || status == nil {
+				status = ""
+			}
+			msgListForOrigin = append(msgListForOrigin, PrivateMessageTimed{Private: private,
+				Timestamp: packet.Timestamp, Status: status.(string)})
 		}
 		privates[origin.(string)] = msgListForOrigin
 		return true
@@ -107,34 +137,93 @@ func (gossiper *Gossiper) constructStatuses() *StatusPacket {
 
 func (gossiper *Gossiper) broadcastGossipPacket(gossipPacket GossipPacket, addresses []*net.UDPAddr) {
 	for _, peer := range addresses {
-		gossiper.ToSend <- PacketToSend{ GossipPacket:&gossipPacket, Address:peer }
+		gossiper.send(PacketToSend{ GossipPacket:&gossipPacket, Address:peer })
 	}
 }
 
-func (gossiper *Gossiper) mineBlock(prevHash [32]byte) {
-	newBlock := Block{ PrevHash:prevHash }
-	var hash [sha256.Size]byte
+/*
+	mine continuously mines blocks on top of the main chain with the pending transactions, and publishes the
+	ones it finds
+ */
+func (gossiper *Gossiper) mine() {
+	for gossiper.ctx.Err() == nil {
+		block := gossiper.createBlockTemplate()
+		hash, found := gossiper.mineBlock(&block)
+		if !found {
+			continue
+		}
+
+		hashHex := hex.EncodeToString(hash[:])
+		if err := gossiper.validateBlock(block); err != nil {
+			println("ERROR : discarding mined block " + hashHex + " : " + err.Error())
+			continue
+		}
+		gossiper.publish(BlockFound{ Hash: hashHex })
+		gossipPacket := GossipPacket{ BlockPublish:&BlockPublish{ Block:block, HopLimit:constants.HOP_LIMIT_BIG } }
+		gossiper.submitBlock(block)
+		gossiper.broadcastGossipPacket(gossipPacket, gossiper.Peers.GetAddresses())
+	}
+}
 
+/*
+	mineBlock looks for a nonce that gives a valid proof of work to the block. It returns false without a hash as soon
+	as the template must be refreshed, because the main chain changed or new transactions arrived, or as soon as the
+	gossiper is stopped
+ */
+func (gossiper *Gossiper) mineBlock(block *Block) ([sha256.Size]byte, bool) {
 	for {
 		select {
-		case <- gossiper.BlockMined:
-			return
+		case <- gossiper.MiningRefresh:
+			return [sha256.Size]byte{}, false
+		case <- gossiper.ctx.Done():
+			return [sha256.Size]byte{}, false
 		default:
-			newBlock.Nonce = generateRandomNounce()
-			hash = newBlock.Hash()
-			if hash[0] == 0 && hash[1] == 0 {
-				break
+			block.Nonce = generateRandomNounce()
+			hash := block.Hash()
+			if hasValidProofOfWork(hash, block.Difficulty) {
+				return hash, true
 			}
 		}
 	}
+}
 
-	newHashHex := hex.EncodeToString(hash[:])
-	gossiper.ToPrint <- "FOUND-BLOCK " + newHashHex
-	gossipPacket := GossipPacket{ BlockPublish:&BlockPublish{ Block:newBlock, HopLimit:constants.HOP_LIMIT_BIG } }
-	gossiper.ToAddToBlockchain <- newBlock
-	gossiper.broadcastGossipPacket(gossipPacket, gossiper.Peers.GetAddresses())
+/*
+	createBlockTemplate returns the block to mine on top of the main chain. It contains the oldest pending
+	transactions whose name is not bound on the main chain yet, up to constants.MAX_TRANSACTIONS_PER_BLOCK of them
+ */
+func (gossiper *Gossiper) createBlockTemplate() Block {
+	prevHashHex := gossiper.CurrentBlock.GetCurrentHash()
+	var prevHash [sha256.Size]byte
+	prevHashBytes, err := hex.DecodeString(prevHashHex)
+	if !util.CheckAndPrintError(err) {
+		copy(prevHash[:], prevHashBytes)
+	}
 
-	gossiper.mineBlock(hash)
+	boundNames := gossiper.getNamesBoundOnBranch(prevHashHex)
+	transactions := make([]TxPublish, 0)
+	for _, transaction := range gossiper.Transactions.getSetCopy() {
+		if len(transactions) >= constants.MAX_TRANSACTIONS_PER_BLOCK {
+			break
+		}
+		if boundNames[transaction.File.Name] || validateTransactionFormat(*transaction) != nil {
+			continue
+		}
+		boundNames[transaction.File.Name] = true
+		transactions = append(transactions, *transaction)
+	}
+	return Block{ PrevHash:prevHash, Transactions:transactions, Difficulty:gossiper.expectedDifficulty(prevHashHex),
+		Timestamp:gossiper.Clock.Now().Unix() }
+}
+
+/*
+	refreshMining asks the miner to rebuild its block template. It never blocks, since one pending request is
+	enough for the miner to take into account all the changes that happened
+ */
+func (gossiper *Gossiper) refreshMining() {
+	select {
+	case gossiper.MiningRefresh <- Signal{}:
+	default:
+	}
 }
 
 func generateRandomNounce() (nounce [32]byte) {
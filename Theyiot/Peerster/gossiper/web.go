@@ -4,9 +4,7 @@ import (
 	"encoding/json"
 	"github.com/Theyiot/Peerster/util"
 	"github.com/gorilla/mux"
-	"log"
 	"net/http"
-	"os"
 )
 
 /*
@@ -62,11 +60,12 @@ func addPeerFromWeb(gossiper *Gossiper) http.HandlerFunc {
 }
 
 /*
-	refreshPeersAddress allows the user to display the latest update of the new peers' addresses on the UI
+	refreshPeersAddress allows the user to display the latest update of the new peers' addresses on the UI, along
+	with whether they are alive, suspect or dead
  */
 func refreshPeersAddress(gossiper *Gossiper) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		peers := gossiper.Peers.GetAddressesAsStringArray()
+		peers := gossiper.getPeersAsList()
 		json.NewEncoder(w).Encode(peers)
 	}
 }
@@ -92,6 +91,27 @@ func refreshPeersName(gossiper *Gossiper) http.HandlerFunc {
 	}
 }
 
+/*
+	listRoutes allows the user to inspect the routing table, namely how the packets for every known peer are routed
+ */
+func listRoutes(gossiper *Gossiper) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		routes := gossiper.getRoutesAsList()
+		json.NewEncoder(w).Encode(routes)
+	}
+}
+
+/*
+	listSendQueues allows the user to inspect, for every peer, how many packets wait to be sent and how many were
+	sent and dropped
+ */
+func listSendQueues(gossiper *Gossiper) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		statistics := gossiper.SendQueues.getStatistics()
+		json.NewEncoder(w).Encode(statistics)
+	}
+}
+
 /*
 	sendPrivateMessage allows to send from the UI some private messages
  */
@@ -175,12 +195,32 @@ func requestFile(gossiper *Gossiper) http.HandlerFunc {
 }
 
 /*
-	This function takes care of starting the web server and to link all the function to the right path
+	requestFileByName allows the user to download from the UI a file whose name is bound on the blockchain
  */
-func (gossiper *Gossiper) StartWebServer(port string) {
-	if !util.CheckValidPort(port) {
-		os.Exit(0)
+func requestFileByName(gossiper *Gossiper) http.HandlerFunc {
+	return func (w http.ResponseWriter, r *http.Request) {
+		var fileName SingleStringJSON
+		if r.Body == nil {
+			http.Error(w, "The request should not be empty", 400)
+			return
+		}
+		err := json.NewDecoder(r.Body).Decode(&fileName)
+		if util.CheckAndPrintError(err) {
+			http.Error(w, err.Error(), 400)
+			return
+		}
+
+		gossiper.requestFileByName(fileName.Text)
+		mapIndexedFiles := gossiper.getIndexedFilesAsMap()
+		json.NewEncoder(w).Encode(mapIndexedFiles)
 	}
+}
+
+/*
+	createWebServer creates the web server listening on the given port of the localhost, and links all the functions
+	to the right path
+ */
+func (gossiper *Gossiper) createWebServer(port string) *http.Server {
 	r := mux.NewRouter()
 
 	// MESSAGES
@@ -197,6 +237,12 @@ func (gossiper *Gossiper) StartWebServer(port string) {
 	// PEER NAMES
 	r.HandleFunc("/name", refreshPeersName(gossiper)).Methods("GET")
 
+	// ROUTING TABLE
+	r.HandleFunc("/routes", listRoutes(gossiper)).Methods("GET")
+
+	// SEND QUEUES
+	r.HandleFunc("/queues", listSendQueues(gossiper)).Methods("GET")
+
 	// PRIVATE MESSAGES
 	r.HandleFunc("/private", receivePrivateMessage(gossiper)).Methods("GET")
 	r.HandleFunc("/private", sendPrivateMessage(gossiper)).Methods("POST")
@@ -205,10 +251,10 @@ func (gossiper *Gossiper) StartWebServer(port string) {
 	r.HandleFunc("/fileIndexing", indexFile(gossiper)).Methods("POST")
 	r.HandleFunc("/fileIndexing", listIndexedFiles(gossiper)).Methods("GET")
 	r.HandleFunc("/fileRequesting", requestFile(gossiper)).Methods("POST")
+	r.HandleFunc("/nameRequesting", requestFileByName(gossiper)).Methods("POST")
 
 	//LINK FRONTEND AND BACKEND
 	r.PathPrefix("/").Handler(http.FileServer(http.Dir("webserver")))
 
-	//LAUNCHING SERVER
-	log.Fatal(http.ListenAndServe("localhost:" + port, r))
+	return &http.Server{ Addr: "localhost:" + port, Handler: r }
 }
\ No newline at end of file
@@ -1,9 +1,58 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"github.com/Theyiot/Peerster/constants"
 	"github.com/Theyiot/Peerster/gossiper"
+	"github.com/Theyiot/Peerster/util"
+	"os"
+	"os/signal"
+	"syscall"
 )
 
+/*
+	main parses the parameters provided by the client, and runs a gossiper until it is interrupted
+ */
 func main() {
-	gossiper.StartGossip()
-}
\ No newline at end of file
+	config := gossiper.DefaultConfig()
+
+	//FLAGS DEFINITION
+	flag.StringVar(&config.UIPort, "UIPort", config.UIPort, "Port for the UI client")
+	flag.StringVar(&config.GossipAddr, "gossipAddr", config.GossipAddr, "ip:port for the receiver")
+	flag.StringVar(&config.Name, "name", config.Name, "name of the gossiper")
+	flag.StringVar(&config.Peers, "peers", "", "comma-separated list of peers of the form ip:port")
+	flag.BoolVar(&config.Simple, "simple", false, "run gossiper in simple broadcast mode")
+	flag.UintVar(&config.Rtimer, "rtimer", 0, "Time between each route rumor")
+	flag.StringVar(&config.DataDir, "dataDir", "", "directory where the state of the gossiper is kept between two runs " +
+		"(default " + constants.PATH_STATE + "<name>)")
+	flag.UintVar(&config.Difficulty, "difficulty", config.Difficulty, "Number of leading zero bits of the hash of the first block")
+	flag.UintVar(&config.Window, "window", config.Window, "Number of chunks requested in parallel when downloading a file")
+	flag.UintVar(&config.RouteExpiry, "routeExpiry", 0, "Seconds after which a route that was not confirmed is removed (0 to keep the routes forever, " +
+		"the default unless rtimer is set)")
+	flag.BoolVar(&config.DirectRoutes, "directRoutes", false, "Advertise our gossip address in our rumors and route directly to the origins advertising theirs")
+	flag.UintVar(&config.SuspectAfter, "suspectAfter", config.SuspectAfter, "Number of status replies a peer misses in a row before being suspect (0 to disable)")
+	flag.UintVar(&config.DeadAfter, "deadAfter", config.DeadAfter, "Number of status replies a peer misses in a row before being considered dead (0 to disable)")
+	flag.UintVar(&config.PeerExchangeTimer, "peerExchange", config.PeerExchangeTimer, "Time between each exchange of peers with a random peer (0 to disable)")
+	flag.UintVar(&config.SendQueueSize, "sendQueue", config.SendQueueSize, "Number of packets of each priority that can wait to be sent to a peer")
+	flag.UintVar(&config.PeerRate, "peerRate", 0, "Maximum number of packets sent per second to a peer (0 for no limit)")
+	flag.UintVar(&config.GlobalRate, "globalRate", 0, "Maximum number of packets sent per second in total (0 for no limit)")
+	flag.UintVar(&config.MailboxReplicas, "mailboxReplicas", 0, "Number of neighbours that keep a copy of the private messages we can not deliver")
+	flag.Parse()
+	routeExpirySet := false
+	flag.Visit(func(f *flag.Flag) {
+		routeExpirySet = routeExpirySet || f.Name == "routeExpiry"
+	})
+	if !routeExpirySet {
+		config.RouteExpiry = gossiper.DefaultRouteExpiry(config.Rtimer)
+	}
+
+	node, err := gossiper.New(config)
+	util.FailOnError(err)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	util.FailOnError(node.Start(ctx))
+	<- ctx.Done()
+	util.CheckAndPrintError(node.Stop())
+}
@@ -0,0 +1,493 @@
+package simulator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Theyiot/Peerster/constants"
+	"github.com/Theyiot/Peerster/gossiper"
+	"github.com/Theyiot/Peerster/util"
+	"github.com/dedis/protobuf"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const GOSSIP_BASE_PORT = 10000
+const UI_BASE_PORT = 20000
+const CLIENT_ADDRESS = "127.0.0.1:30000"
+const DEFAULT_STEP = 100 * time.Millisecond
+const DEFAULT_SETTLE = 2 * time.Millisecond
+const EVENTS_BUFFER_SIZE = 4096
+
+/*
+	Config describes a simulation : the number of nodes and how they are linked, the seed of every random choice
+	made by the simulator, the conditions of the links, the timers of the gossipers (in seconds, 0 to disable) and the
+	number of status replies a peer misses before being suspect or dead (0 to disable).
+	The virtual clock moves forward by Step at a time, and the nodes get Settle of real time to react after each step
+ */
+type Config struct {
+	Nodes				int
+	Topology			Topology
+	Seed				int64
+	Loss				float64
+	Delay				time.Duration
+	Jitter				time.Duration
+	Rtimer				uint
+	PeerExchangeTimer	uint
+	Mining				bool
+	SuspectAfter		uint
+	DeadAfter			uint
+	Step				time.Duration
+	Settle				time.Duration
+}
+
+/*
+	A Simulation runs several gossipers in a single process. They communicate through a MemoryNetwork and share a
+	VirtualClock, so that minutes of protocol can be simulated in a few seconds. The topology, the losses and the
+	delays only depend on the seed, but the goroutines of the gossipers still run concurrently, so a scenario should
+	assert on properties that eventually hold, with Eventually, rather than on exact interleavings
+ */
+type Simulation struct {
+	config				Config
+	Network				*util.MemoryNetwork
+	Clock				*util.VirtualClock
+	Nodes				[]*gossiper.Gossiper
+	Links				[][2]int
+	client				*util.MemoryTransport
+	crashed				[]bool
+	events				[][]gossiper.Event
+	dataDir				string
+	lock				sync.Mutex
+}
+
+/*
+	New creates and starts a simulation with the given config. The state of the nodes is kept in a temporary
+	directory, removed by Close
+ */
+func New(config Config) (*Simulation, error) {
+	if config.Topology == nil {
+		config.Topology = Line
+	}
+	if config.Step == 0 {
+		config.Step = DEFAULT_STEP
+	}
+	if config.Settle == 0 {
+		config.Settle = DEFAULT_SETTLE
+	}
+	dataDir, err := ioutil.TempDir("", "peerster-simulation")
+	if err != nil {
+		return nil, err
+	}
+
+	simulation := &Simulation{
+		config:		config,
+		Network:	util.CreateMemoryNetwork(config.Seed),
+		Clock:		util.CreateVirtualClock(time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)),
+		Links:		config.Topology(config.Nodes, rand.New(rand.NewSource(config.Seed))),
+		crashed:	make([]bool, config.Nodes),
+		events:		make([][]gossiper.Event, config.Nodes),
+		dataDir:	dataDir,
+	}
+	simulation.Network.SetClock(simulation.Clock)
+	simulation.Network.SetConditions(util.LinkConditions{ Loss: config.Loss, Delay: config.Delay, Jitter: config.Jitter })
+	simulation.setClientLinks()
+
+	simulation.client, err = simulation.Network.Listen(CLIENT_ADDRESS)
+	if err != nil {
+		simulation.Close()
+		return nil, err
+	}
+	for i := 0; i < config.Nodes; i++ {
+		if err := simulation.createNode(i); err != nil {
+			simulation.Close()
+			return nil, err
+		}
+	}
+	for _, link := range simulation.Links {
+		simulation.Nodes[link[0]].Peers.Add(simulation.Nodes[link[1]].GossipAddr)
+		simulation.Nodes[link[1]].Peers.Add(simulation.Nodes[link[0]].GossipAddr)
+	}
+	for i, node := range simulation.Nodes {
+		events, unsubscribe := node.Events.Subscribe(EVENTS_BUFFER_SIZE)
+		go simulation.collectEvents(i, node, events, unsubscribe)
+		if err := node.Start(context.Background()); err != nil {
+			simulation.Close()
+			return nil, err
+		}
+	}
+	return simulation, nil
+}
+
+/*
+	createNode creates the i-th node of the simulation, named nodeI, without starting it. Its events are kept by
+	collectEvents instead of being printed
+ */
+func (simulation *Simulation) createNode(i int) error {
+	gossipServer, err := simulation.Network.Listen(GossipAddress(i))
+	if err != nil {
+		return err
+	}
+	uiServer, err := simulation.Network.Listen(UIAddress(i))
+	if err != nil {
+		gossipServer.Close()
+		return err
+	}
+
+	config := gossiper.DefaultConfig()
+	config.Name = NodeName(i)
+	config.DataDir = filepath.Join(simulation.dataDir, config.Name)
+	config.Rtimer = simulation.config.Rtimer
+	config.RouteExpiry = gossiper.DefaultRouteExpiry(simulation.config.Rtimer)
+	config.PeerExchangeTimer = simulation.config.PeerExchangeTimer
+	config.Mining = simulation.config.Mining
+	config.SuspectAfter = simulation.config.SuspectAfter
+	config.DeadAfter = simulation.config.DeadAfter
+	config.WebServer = false
+	config.GossipServer = gossipServer
+	config.UIServer = uiServer
+	config.Clock = simulation.Clock
+	config.Output = nil
+	node, err := gossiper.New(config)
+	if err != nil {
+		gossipServer.Close()
+		uiServer.Close()
+		return err
+	}
+	simulation.Nodes = append(simulation.Nodes, node)
+	return nil
+}
+
+/*
+	collectEvents keeps the events of the i-th node until it is stopped, so that scenarios can check them
+ */
+func (simulation *Simulation) collectEvents(i int, node *gossiper.Gossiper, events <-chan gossiper.Event,
+	unsubscribe func()) {
+	defer unsubscribe()
+	for {
+		select {
+		case event := <- events:
+			simulation.lock.Lock()
+			simulation.events[i] = append(simulation.events[i], event)
+			simulation.lock.Unlock()
+		case <- node.Done():
+			return
+		}
+	}
+}
+
+/*
+	NodeName returns the name of the i-th node of a simulation
+ */
+func NodeName(i int) string {
+	return fmt.Sprintf("node%d", i)
+}
+
+/*
+	GossipAddress returns the address on which the i-th node of a simulation receives gossip packets
+ */
+func GossipAddress(i int) string {
+	return fmt.Sprintf("127.0.0.1:%d", GOSSIP_BASE_PORT + i)
+}
+
+/*
+	UIAddress returns the address on which the i-th node of a simulation receives client packets
+ */
+func UIAddress(i int) string {
+	return fmt.Sprintf("127.0.0.1:%d", UI_BASE_PORT + i)
+}
+
+/*
+	Advance moves the virtual time forward by the given duration, one step at a time, letting the nodes react
+	after each step
+ */
+func (simulation *Simulation) Advance(duration time.Duration) {
+	for elapsed := time.Duration(0); elapsed < duration; elapsed += simulation.config.Step {
+		simulation.Clock.Advance(simulation.config.Step)
+		time.Sleep(simulation.config.Settle)
+	}
+}
+
+/*
+	Eventually advances the virtual time until the assertion holds, and returns the last error of the assertion if
+	it still does not hold after the given virtual timeout
+ */
+func (simulation *Simulation) Eventually(timeout time.Duration, assertion func() error) error {
+	for elapsed := time.Duration(0); ; elapsed += simulation.config.Step {
+		err := assertion()
+		if err == nil || elapsed >= timeout {
+			return err
+		}
+		simulation.Advance(simulation.config.Step)
+	}
+}
+
+/*
+	sendToClient sends a client packet to the i-th node, as the client program would
+ */
+func (simulation *Simulation) sendToClient(i int, packet gossiper.ClientPacket) error {
+	bytes, err := protobuf.Encode(&packet)
+	if err != nil {
+		return err
+	}
+	udpAddr, err := net.ResolveUDPAddr(constants.UDP_VERSION, UIAddress(i))
+	if err != nil {
+		return err
+	}
+	return simulation.client.Send(bytes, udpAddr)
+}
+
+/*
+	SendRumor asks the i-th node to gossip a rumor with the given text
+ */
+func (simulation *Simulation) SendRumor(i int, text string) error {
+	return simulation.sendToClient(i, gossiper.ClientPacket{ Simple: &gossiper.SimpleMessage{ Contents: text } })
+}
+
+/*
+	SendPrivate asks the i-th node to send a private message with the given text to the j-th node
+ */
+func (simulation *Simulation) SendPrivate(i, j int, text string) error {
+	return simulation.sendToClient(i, gossiper.ClientPacket{
+		Private: &gossiper.PrivateMessage{ Destination: NodeName(j), Text: text },
+	})
+}
+
+/*
+	Search asks the i-th node to search for files matching the keywords, with the given budget
+	(constants.DEFAULT_BUDGET for a budget that doubles until enough files are found)
+ */
+func (simulation *Simulation) Search(i int, keywords []string, budget uint64) error {
+	return simulation.sendToClient(i, gossiper.ClientPacket{
+		FileSearchRequest: &gossiper.SearchRequestMessage{ Keywords: keywords, Budget: budget },
+	})
+}
+
+/*
+	IndexFile asks the i-th node to index a file of the "_SharedFiles" folder. The folders of the files are the ones
+	of the current directory, shared by all the nodes of the simulation
+ */
+func (simulation *Simulation) IndexFile(i int, fileName string) error {
+	return simulation.sendToClient(i, gossiper.ClientPacket{ FileIndex: &gossiper.FileIndexMessage{ FileName: fileName } })
+}
+
+/*
+	RequestFile asks the i-th node to download the file with the given metahash from the j-th node, and to store it
+	under the given name in the "_Downloads" folder
+ */
+func (simulation *Simulation) RequestFile(i, j int, fileName, metaHashHex string) error {
+	return simulation.sendToClient(i, gossiper.ClientPacket{
+		FileRequest: &gossiper.FileRequestMessage{ FileName: fileName, Destination: NodeName(j), Request: metaHashHex },
+	})
+}
+
+/*
+	Partition splits the network into the given groups of nodes : the datagrams between two nodes of different
+	groups are lost. A node that is in no group is isolated from every other node
+ */
+func (simulation *Simulation) Partition(groups ...[]int) {
+	group := make([]int, len(simulation.Nodes))
+	for i := range group {
+		group[i] = -1 - i
+	}
+	for g, nodes := range groups {
+		for _, i := range nodes {
+			group[i] = g
+		}
+	}
+	lost := util.LinkConditions{ Loss: 1 }
+	for a := range simulation.Nodes {
+		for b := range simulation.Nodes {
+			if group[a] != group[b] {
+				simulation.Network.SetLinkConditions(GossipAddress(a), GossipAddress(b), lost)
+			}
+		}
+	}
+}
+
+/*
+	Heal removes the partitions, every link between two nodes gets back the conditions of the config
+ */
+func (simulation *Simulation) Heal() {
+	simulation.Network.ResetLinkConditions()
+	simulation.setClientLinks()
+}
+
+/*
+	setClientLinks makes the links from the client to the nodes perfect, as the client runs on the same host as the
+	node it talks to
+ */
+func (simulation *Simulation) setClientLinks() {
+	for i := 0; i < simulation.config.Nodes; i++ {
+		simulation.Network.SetLinkConditions(CLIENT_ADDRESS, UIAddress(i), util.LinkConditions{})
+	}
+}
+
+/*
+	Crash stops the i-th node, as if its process was killed
+ */
+func (simulation *Simulation) Crash(i int) error {
+	simulation.lock.Lock()
+	if simulation.crashed[i] {
+		simulation.lock.Unlock()
+		return nil
+	}
+	simulation.crashed[i] = true
+	simulation.lock.Unlock()
+	return simulation.Nodes[i].Stop()
+}
+
+/*
+	IsCrashed returns whether the i-th node was crashed
+ */
+func (simulation *Simulation) IsCrashed(i int) bool {
+	simulation.lock.Lock()
+	defer simulation.lock.Unlock()
+	return simulation.crashed[i]
+}
+
+/*
+	Events returns the events the i-th node published so far
+ */
+func (simulation *Simulation) Events(i int) []gossiper.Event {
+	simulation.lock.Lock()
+	defer simulation.lock.Unlock()
+	return append([]gossiper.Event(nil), simulation.events[i]...)
+}
+
+/*
+	Output returns what the i-th node would have printed so far
+ */
+func (simulation *Simulation) Output(i int) []string {
+	output := make([]string, 0)
+	for _, event := range simulation.Events(i) {
+		if str := event.Text(); str != "" {
+			output = append(output, str)
+		}
+	}
+	return output
+}
+
+/*
+	liveNodes returns the indices of the nodes that were not crashed
+ */
+func (simulation *Simulation) liveNodes() []int {
+	live := make([]int, 0, len(simulation.Nodes))
+	for i := range simulation.Nodes {
+		if !simulation.IsCrashed(i) {
+			live = append(live, i)
+		}
+	}
+	return live
+}
+
+/*
+	vectorClockOf returns the vector clock of the i-th node as a string, sorted by origin
+ */
+func (simulation *Simulation) vectorClockOf(i int) string {
+	entries := make([]string, 0)
+	simulation.Nodes[i].VectorClock.Range(func(origin, nextID interface{}) bool {
+		entries = append(entries, fmt.Sprintf("%s=%d", origin.(string), nextID.(uint32)))
+		return true
+	})
+	sort.Strings(entries)
+	return strings.Join(entries, " ")
+}
+
+/*
+	AssertVectorClocksConverged checks that all the nodes that were not crashed have the same VectorClock. It fails
+	if every node was crashed
+ */
+func (simulation *Simulation) AssertVectorClocksConverged() error {
+	live := simulation.liveNodes()
+	if len(live) == 0 {
+		return errors.New("no node is running")
+	}
+	for _, i := range live[1:] {
+		if expected, actual := simulation.vectorClockOf(live[0]), simulation.vectorClockOf(i); expected != actual {
+			return fmt.Errorf("%s has vector clock [%s] while %s has [%s]", NodeName(i), actual, NodeName(live[0]), expected)
+		}
+	}
+	return nil
+}
+
+/*
+	AssertSameCurrentBlock checks that all the nodes that were not crashed have the same CurrentBlock. It fails if
+	every node was crashed
+ */
+func (simulation *Simulation) AssertSameCurrentBlock() error {
+	live := simulation.liveNodes()
+	if len(live) == 0 {
+		return errors.New("no node is running")
+	}
+	for _, i := range live[1:] {
+		expected := simulation.Nodes[live[0]].CurrentBlock.GetCurrentHash()
+		if actual := simulation.Nodes[i].CurrentBlock.GetCurrentHash(); expected != actual {
+			return fmt.Errorf("%s has current block %s while %s has %s", NodeName(i), actual, NodeName(live[0]), expected)
+		}
+	}
+	return nil
+}
+
+/*
+	AssertRoutesToAll checks that every node that was not crashed has a route to every other one. It fails if every
+	node was crashed
+ */
+func (simulation *Simulation) AssertRoutesToAll() error {
+	live := simulation.liveNodes()
+	if len(live) == 0 {
+		return errors.New("no node is running")
+	}
+	for _, i := range live {
+		for _, j := range live {
+			if _, ok := simulation.Nodes[i].DSDV.GetNextHop(NodeName(j)); i != j && !ok {
+				return fmt.Errorf("%s has no route to %s", NodeName(i), NodeName(j))
+			}
+		}
+	}
+	return nil
+}
+
+/*
+	AssertPrinted checks that the i-th node printed a line containing the given text
+ */
+func (simulation *Simulation) AssertPrinted(i int, text string) error {
+	for _, str := range simulation.Output(i) {
+		if strings.Contains(str, text) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s did not print %q", NodeName(i), text)
+}
+
+/*
+	AssertEvent checks that the i-th node published an event for which match returns true. The description of the
+	expected event is used in the error
+ */
+func (simulation *Simulation) AssertEvent(i int, description string, match func(gossiper.Event) bool) error {
+	for _, event := range simulation.Events(i) {
+		if match(event) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s did not publish %s", NodeName(i), description)
+}
+
+/*
+	Close stops every node and removes their state
+ */
+func (simulation *Simulation) Close() error {
+	for i := range simulation.Nodes {
+		util.CheckAndPrintError(simulation.Crash(i))
+	}
+	if simulation.client != nil {
+		simulation.client.Close()
+	}
+	return os.RemoveAll(simulation.dataDir)
+}
@@ -0,0 +1,402 @@
+package simulator
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/Theyiot/Peerster/constants"
+	"github.com/Theyiot/Peerster/gossiper"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const CONVERGENCE_TIMEOUT = 120 * time.Second
+
+/*
+	startSimulation creates a simulation from the given config, and closes it at the end of the test
+ */
+func startSimulation(t *testing.T, config Config) *Simulation {
+	t.Helper()
+	simulation, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := simulation.Close(); err != nil {
+			t.Error(err)
+		}
+	})
+	return simulation
+}
+
+/*
+	sendRumorToAll makes the i-th node gossip a rumor, and waits for every other node that was not crashed to print
+	it
+ */
+func sendRumorToAll(t *testing.T, simulation *Simulation, i int, text string) {
+	t.Helper()
+	if err := simulation.SendRumor(i, text); err != nil {
+		t.Fatal(err)
+	}
+	for _, j := range simulation.liveNodes() {
+		if j == i {
+			continue
+		}
+		j := j
+		err := simulation.Eventually(CONVERGENCE_TIMEOUT, func() error {
+			return simulation.AssertPrinted(j, "contents " + text)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+/*
+	inFilesDir makes the test run in a temporary directory holding the folders of the files, which are shared by all
+	the nodes
+ */
+func inFilesDir(t *testing.T) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	for _, folder := range []string{ constants.PATH_SHARED_FILES, constants.PATH_DOWNOADS, constants.PATH_FILE_CHUNKS } {
+		if err := os.MkdirAll(filepath.Join(dir, folder), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := os.Chdir(wd); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+/*
+	writeSharedFile fills a file of the "_SharedFiles" folder with size random bytes, and returns them
+ */
+func writeSharedFile(t *testing.T, fileName string, size int, seed int64) []byte {
+	t.Helper()
+	data := make([]byte, size)
+	rand.New(rand.NewSource(seed)).Read(data)
+	if err := ioutil.WriteFile(constants.PATH_SHARED_FILES + fileName, data, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+/*
+	indexedMetaHash waits for the i-th node to index the file with the given name, and returns its metahash
+ */
+func indexedMetaHash(t *testing.T, simulation *Simulation, i int, fileName string) string {
+	t.Helper()
+	metaHashHex := ""
+	err := simulation.Eventually(CONVERGENCE_TIMEOUT, func() error {
+		simulation.Nodes[i].IndexedFiles.Range(func(hash, indexedFile interface{}) bool {
+			if indexedFile.(gossiper.IndexedFile).FileName == fileName {
+				metaHashHex = hash.(string)
+			}
+			return metaHashHex == ""
+		})
+		if metaHashHex == "" {
+			return fmt.Errorf("%s did not index %s", NodeName(i), fileName)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return metaHashHex
+}
+
+func TestLineConverges(t *testing.T) {
+	simulation := startSimulation(t, Config{ Nodes: 5, Topology: Line, Seed: 1 })
+	sendRumorToAll(t, simulation, 0, "first")
+	sendRumorToAll(t, simulation, 4, "last")
+
+	if err := simulation.Eventually(CONVERGENCE_TIMEOUT, simulation.AssertVectorClocksConverged); err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i < 4; i++ {
+		for _, origin := range []int{ 0, 4 } {
+			if _, exist := simulation.Nodes[i].DSDV.GetNextHop(NodeName(origin)); !exist {
+				t.Fatalf("%s has no route to %s", NodeName(i), NodeName(origin))
+			}
+		}
+	}
+}
+
+func TestRingConvergesWithLoss(t *testing.T) {
+	simulation := startSimulation(t, Config{ Nodes: 6, Topology: Ring, Seed: 2, Loss: 0.1,
+		Delay: 20 * time.Millisecond, Jitter: 10 * time.Millisecond, Rtimer: 5 })
+	sendRumorToAll(t, simulation, 0, "hello")
+	sendRumorToAll(t, simulation, 3, "world")
+
+	if err := simulation.Eventually(CONVERGENCE_TIMEOUT, simulation.AssertVectorClocksConverged); err != nil {
+		t.Fatal(err)
+	}
+	if err := simulation.Eventually(CONVERGENCE_TIMEOUT, simulation.AssertRoutesToAll); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMiningAgreesOnCurrentBlock(t *testing.T) {
+	simulation := startSimulation(t, Config{ Nodes: 4, Topology: RandomGraph(0.3), Seed: 3, Mining: true })
+	simulation.Advance(30 * time.Second)
+
+	if err := simulation.Eventually(CONVERGENCE_TIMEOUT, simulation.AssertSameCurrentBlock); err != nil {
+		t.Fatal(err)
+	}
+	if depth := simulation.Nodes[0].CurrentBlock.GetDepth(); depth == 0 {
+		t.Fatal("no block was mined")
+	}
+}
+
+func TestForkResolvesToOneChain(t *testing.T) {
+	simulation := startSimulation(t, Config{ Nodes: 4, Topology: Ring, Seed: 6, Mining: true })
+	simulation.Partition([]int{ 0, 1 }, []int{ 2, 3 })
+
+	// BOTH SIDES OF THE PARTITION MINE THEIR OWN BRANCH
+	err := simulation.Eventually(CONVERGENCE_TIMEOUT, func() error {
+		for _, i := range []int{ 0, 2 } {
+			if simulation.Nodes[i].CurrentBlock.GetDepth() == 0 {
+				return fmt.Errorf("%s did not mine any block", NodeName(i))
+			}
+		}
+		if simulation.Nodes[0].CurrentBlock.GetCurrentHash() == simulation.Nodes[2].CurrentBlock.GetCurrentHash() {
+			return errors.New("the partition did not fork the chain")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	simulation.Heal()
+	if err := simulation.Eventually(CONVERGENCE_TIMEOUT, simulation.AssertSameCurrentBlock); err != nil {
+		t.Fatal(err)
+	}
+	// THE NODES OF AT LEAST ONE SIDE REWOUND THEIR BRANCH TO SWITCH TO THE OTHER ONE
+	rewound := false
+	for i := range simulation.Nodes {
+		err := simulation.AssertEvent(i, "a longer fork", func(event gossiper.Event) bool {
+			fork, ok := event.(gossiper.ForkDetected)
+			return ok && fork.Longer && fork.Rewound > 0
+		})
+		rewound = rewound || err == nil
+	}
+	if !rewound {
+		t.Fatal("no node switched to a longer fork")
+	}
+}
+
+func TestSearchExpandsBudget(t *testing.T) {
+	inFilesDir(t)
+	writeSharedFile(t, "report-a.txt", 1000, 1)
+	writeSharedFile(t, "report-b.txt", 1000, 2)
+	simulation := startSimulation(t, Config{ Nodes: 5, Topology: Line, Seed: 7 })
+	if err := simulation.IndexFile(4, "report-a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := simulation.IndexFile(3, "report-b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	indexedMetaHash(t, simulation, 4, "report-a.txt")
+	indexedMetaHash(t, simulation, 3, "report-b.txt")
+
+	// A BUDGET OF 3 REACHES THE NODES AT MOST 3 HOPS AWAY
+	if err := simulation.Search(0, []string{ "report" }, 3); err != nil {
+		t.Fatal(err)
+	}
+	err := simulation.Eventually(CONVERGENCE_TIMEOUT, func() error {
+		return simulation.AssertPrinted(0, "FOUND match report-b.txt at node3")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	simulation.Advance(5 * time.Second)
+	if err := simulation.AssertPrinted(0, "FOUND match report-a.txt at node4"); err == nil {
+		t.Fatal("the search went further than its budget")
+	}
+	if err := simulation.AssertPrinted(0, "SEARCH FINISHED"); err == nil {
+		t.Fatal("the search finished with a single match")
+	}
+
+	// THE DEFAULT BUDGET DOUBLES UNTIL BOTH FILES ARE FOUND
+	if err := simulation.Search(0, []string{ "report" }, constants.DEFAULT_BUDGET); err != nil {
+		t.Fatal(err)
+	}
+	for _, text := range []string{ "FOUND match report-a.txt at node4", "SEARCH FINISHED" } {
+		text := text
+		err := simulation.Eventually(CONVERGENCE_TIMEOUT, func() error {
+			return simulation.AssertPrinted(0, text)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestPrivateDelivery(t *testing.T) {
+	simulation := startSimulation(t, Config{ Nodes: 4, Topology: Line, Seed: 8 })
+
+	// WITHOUT ANY ROUTE TO ITS DESTINATION, A PRIVATE MESSAGE WAITS IN THE MAILBOX
+	if err := simulation.SendPrivate(0, 3, "early"); err != nil {
+		t.Fatal(err)
+	}
+	err := simulation.Eventually(CONVERGENCE_TIMEOUT, func() error {
+		return simulation.AssertPrinted(0, "QUEUED private message 1 for node3")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// THE RUMORS OF THE DESTINATION FLUSH THE MAILBOX, AND THE ONES OF THE ORIGIN ROUTE THE ACKNOWLEDGEMENTS
+	sendRumorToAll(t, simulation, 3, "here")
+	sendRumorToAll(t, simulation, 0, "there")
+
+	if err := simulation.SendPrivate(0, 3, "late"); err != nil {
+		t.Fatal(err)
+	}
+	for _, text := range []string{ "early", "late" } {
+		text := text
+		err := simulation.Eventually(CONVERGENCE_TIMEOUT, func() error {
+			return simulation.AssertPrinted(3, "PRIVATE origin node0 hop-limit " +
+				fmt.Sprint(constants.DEFAULT_HOP_LIMIT - 2) + " contents " + text)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for id := uint32(1); id <= 2; id++ {
+		id := id
+		err := simulation.Eventually(CONVERGENCE_TIMEOUT, func() error {
+			return simulation.AssertEvent(0, "the acknowledgement of private " + fmt.Sprint(id),
+				func(event gossiper.Event) bool {
+					ack, ok := event.(gossiper.PrivateAcknowledged)
+					return ok && ack.Origin == NodeName(3) && ack.ID == id
+				})
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, i := range []int{ 1, 2 } {
+		if err := simulation.AssertPrinted(i, "contents late"); err == nil {
+			t.Fatalf("the relay %s read a private message", NodeName(i))
+		}
+	}
+}
+
+func TestFileDownloadThroughRelays(t *testing.T) {
+	inFilesDir(t)
+	data := writeSharedFile(t, "data.bin", 3 * constants.CHUNK_SIZE + 100, 3)
+	simulation := startSimulation(t, Config{ Nodes: 4, Topology: Line, Seed: 9 })
+	if err := simulation.IndexFile(0, "data.bin"); err != nil {
+		t.Fatal(err)
+	}
+	metaHashHex := indexedMetaHash(t, simulation, 0, "data.bin")
+	sendRumorToAll(t, simulation, 0, "route")
+
+	if err := simulation.RequestFile(3, 0, "copy.bin", metaHashHex); err != nil {
+		t.Fatal(err)
+	}
+	err := simulation.Eventually(CONVERGENCE_TIMEOUT, func() error {
+		return simulation.AssertPrinted(3, "RECONSTRUCTED file copy.bin")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	downloaded, err := ioutil.ReadFile(constants.PATH_DOWNOADS + "copy.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(downloaded, data) {
+		t.Fatal("the downloaded file differs from the indexed one")
+	}
+	for chunk := 1; chunk <= 4; chunk++ {
+		chunk := chunk
+		err := simulation.AssertEvent(3, "the download of chunk " + fmt.Sprint(chunk), func(event gossiper.Event) bool {
+			downloaded, ok := event.(gossiper.ChunkDownloaded)
+			return ok && downloaded.Chunk == chunk && downloaded.From == NodeName(0)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestPartitionHeals(t *testing.T) {
+	simulation := startSimulation(t, Config{ Nodes: 4, Topology: Ring, Seed: 4, SuspectAfter: 1, DeadAfter: 2 })
+	sendRumorToAll(t, simulation, 0, "before")
+
+	simulation.Partition([]int{ 0, 1 }, []int{ 2, 3 })
+	for i := 0; i < 10; i++ {
+		if err := simulation.SendRumor(0, "during " + fmt.Sprint(i)); err != nil {
+			t.Fatal(err)
+		}
+		simulation.Advance(5 * time.Second)
+	}
+	if err := simulation.AssertPrinted(2, "contents during 9"); err == nil {
+		t.Fatal("the rumor crossed the partition")
+	}
+	// THE PEERS ACROSS THE PARTITION ARE DEAD, AND MUST BE PROBED TO BE USED AGAIN ONCE IT IS HEALED
+	err := simulation.AssertEvent(1, "a dead peer", func(event gossiper.Event) bool {
+		changed, ok := event.(gossiper.PeerStateChanged)
+		return ok && changed.State == constants.PEER_DEAD
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	simulation.Heal()
+	for i := 1; i < len(simulation.Nodes); i++ {
+		i := i
+		err := simulation.Eventually(CONVERGENCE_TIMEOUT, func() error {
+			return simulation.AssertPrinted(i, "contents during 9")
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := simulation.Eventually(CONVERGENCE_TIMEOUT, simulation.AssertVectorClocksConverged); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCrash(t *testing.T) {
+	simulation := startSimulation(t, Config{ Nodes: 4, Topology: Ring, Seed: 5 })
+	sendRumorToAll(t, simulation, 0, "before")
+
+	if err := simulation.Crash(2); err != nil {
+		t.Fatal(err)
+	}
+	sendRumorToAll(t, simulation, 1, "after")
+	if err := simulation.Eventually(CONVERGENCE_TIMEOUT, simulation.AssertVectorClocksConverged); err != nil {
+		t.Fatal(err)
+	}
+	if err := simulation.AssertPrinted(2, "contents after"); err == nil {
+		t.Fatal("a crashed node received a rumor")
+	}
+
+	for i := range simulation.Nodes {
+		if err := simulation.Crash(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := simulation.AssertVectorClocksConverged(); err == nil {
+		t.Fatal("the vector clocks converged without any running node")
+	}
+	if err := simulation.AssertSameCurrentBlock(); err == nil {
+		t.Fatal("the current blocks agreed without any running node")
+	}
+}
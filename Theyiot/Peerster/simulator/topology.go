@@ -0,0 +1,66 @@
+package simulator
+
+import (
+	"math/rand"
+)
+
+/*
+	A Topology gives the initial links between the nodes of a simulation, as pairs of node indices. Each link makes
+	both nodes know the other one as a peer. The random source is seeded with the seed of the simulation
+ */
+type Topology func(nodes int, random *rand.Rand) [][2]int
+
+/*
+	Line links every node to the next one, the first and the last nodes having a single peer
+ */
+func Line(nodes int, _ *rand.Rand) [][2]int {
+	links := make([][2]int, 0, nodes)
+	for i := 0; i + 1 < nodes; i++ {
+		links = append(links, [2]int{ i, i + 1 })
+	}
+	return links
+}
+
+/*
+	Ring links every node to the next one, and the last node to the first one
+ */
+func Ring(nodes int, random *rand.Rand) [][2]int {
+	links := Line(nodes, random)
+	if nodes > 2 {
+		links = append(links, [2]int{ nodes - 1, 0 })
+	}
+	return links
+}
+
+/*
+	RandomGraph returns a Topology where each pair of nodes is linked with the given probability. A random spanning
+	tree is added so that the graph is always connected
+ */
+func RandomGraph(probability float64) Topology {
+	return func(nodes int, random *rand.Rand) [][2]int {
+		linked := make(map[[2]int]bool)
+		links := make([][2]int, 0)
+		addLink := func(a, b int) {
+			if a > b {
+				a, b = b, a
+			}
+			if a != b && !linked[[2]int{ a, b }] {
+				linked[[2]int{ a, b }] = true
+				links = append(links, [2]int{ a, b })
+			}
+		}
+
+		order := random.Perm(nodes)
+		for i := 1; i < nodes; i++ {
+			addLink(order[i], order[random.Intn(i)])
+		}
+		for a := 0; a < nodes; a++ {
+			for b := a + 1; b < nodes; b++ {
+				if random.Float64() < probability {
+					addLink(a, b)
+				}
+			}
+		}
+		return links
+	}
+}
@@ -6,11 +6,28 @@ import (
 	"net"
 	"strings"
 	"sync"
+	"time"
 )
 
 type AddrSet struct {
-	addresses []*net.UDPAddr
-	lock      sync.RWMutex
+	addresses		[]*net.UDPAddr
+	liveness		map[string]*PeerLiveness
+	suspectAfter	uint
+	deadAfter		uint
+	clock			Clock
+	lock			sync.RWMutex
+}
+
+/*
+	A PeerLiveness tells when we last received a packet from a peer, how many status replies it missed in a row
+	since then, and whether it is alive, suspect or dead
+ */
+type PeerLiveness struct {
+	Address			string
+	LastReceived	time.Time
+	MissedReplies	uint
+	State			string
+	DeadSince		time.Time
 }
 
 /*
@@ -26,10 +43,215 @@ func (set *AddrSet) Add(address string) {
 
 		set.lock.Lock()
 		set.addresses = append(set.addresses, peerAddr)
+		set.liveness[peerAddr.String()] = &PeerLiveness{ Address: peerAddr.String(), State: constants.PEER_ALIVE }
 		set.lock.Unlock()
 	}
 }
 
+/*
+	AddBounded adds a peer that contacted us or that another peer told us about, as long as the set has less than
+	maxSize peers. When the set is full, a dead peer is forgotten to make room for the new one. It returns whether
+	the peer was added
+ */
+func (set *AddrSet) AddBounded(address string, maxSize int) bool {
+	if !IsValidAddress(address) {
+		return false
+	}
+	peerAddr, err := net.ResolveUDPAddr(constants.UDP_VERSION, address)
+	if CheckAndPrintError(err) {
+		return false
+	}
+
+	set.lock.Lock()
+	defer set.lock.Unlock()
+	if _, exist := set.liveness[peerAddr.String()]; exist {
+		return false
+	}
+	if len(set.addresses) >= maxSize {
+		deadIndex := -1
+		for i, addr := range set.addresses {
+			if set.liveness[addr.String()].State == constants.PEER_DEAD {
+				deadIndex = i
+				break
+			}
+		}
+		if deadIndex < 0 {
+			return false
+		}
+		delete(set.liveness, set.addresses[deadIndex].String())
+		set.addresses = append(set.addresses[:deadIndex], set.addresses[deadIndex+1:]...)
+	}
+	set.addresses = append(set.addresses, peerAddr)
+	set.liveness[peerAddr.String()] = &PeerLiveness{ Address: peerAddr.String(), State: constants.PEER_ALIVE }
+	return true
+}
+
+/*
+	SamplePeers returns at most size addresses of peers that are not dead, except the given one. Peers we received
+	a packet from during the last recentWindow come first, and the sample spreads over as many different IP
+	addresses as possible
+ */
+func (set *AddrSet) SamplePeers(size int, except string, recentWindow time.Duration) []string {
+	set.lock.RLock()
+	recent, others := make([]*net.UDPAddr, 0), make([]*net.UDPAddr, 0)
+	for _, addr := range set.liveAddresses() {
+		liveness := set.liveness[addr.String()]
+		if strings.EqualFold(addr.String(), except) {
+			continue
+		} else if liveness.State == constants.PEER_ALIVE && !liveness.LastReceived.IsZero() &&
+			set.clock.Now().Sub(liveness.LastReceived) <= recentWindow {
+			recent = append(recent, addr)
+		} else {
+			others = append(others, addr)
+		}
+	}
+	set.lock.RUnlock()
+	rand.Shuffle(len(recent), func(i, j int) { recent[i], recent[j] = recent[j], recent[i] })
+	rand.Shuffle(len(others), func(i, j int) { others[i], others[j] = others[j], others[i] })
+	candidates := append(recent, others...)
+
+	// EACH ROUND TAKES AT MOST ONE PEER PER IP ADDRESS, SO THAT THE SAMPLE IS AS DIVERSE AS POSSIBLE
+	sample := make([]string, 0, size)
+	taken := make([]bool, len(candidates))
+	for len(sample) < size && len(sample) < len(candidates) {
+		ipsOfRound := make(map[string]bool)
+		for i, addr := range candidates {
+			if taken[i] || ipsOfRound[addr.IP.String()] || len(sample) >= size {
+				continue
+			}
+			ipsOfRound[addr.IP.String()] = true
+			taken[i] = true
+			sample = append(sample, addr.String())
+		}
+	}
+	return sample
+}
+
+/*
+	SetLivenessThresholds sets the number of status replies a peer has to miss in a row to become suspect, and then
+	dead. Dead peers are not chosen until they send us a packet again, which they can do when we probe them
+ */
+func (set *AddrSet) SetLivenessThresholds(suspectAfter, deadAfter uint) {
+	set.lock.Lock()
+	defer set.lock.Unlock()
+	set.suspectAfter, set.deadAfter = suspectAfter, deadAfter
+}
+
+/*
+	MarkReceived records that we received a packet from the given address, which makes the peer alive again. It
+	returns whether the peer was not alive before
+ */
+func (set *AddrSet) MarkReceived(address string) bool {
+	set.lock.Lock()
+	defer set.lock.Unlock()
+	liveness, exist := set.liveness[address]
+	if !exist {
+		return false
+	}
+	revived := liveness.State != constants.PEER_ALIVE
+	liveness.LastReceived, liveness.MissedReplies, liveness.State = set.clock.Now(), 0, constants.PEER_ALIVE
+	return revived
+}
+
+/*
+	MarkMissedReply records that the peer with the given address did not answer to a packet that expected a status
+	reply. It returns the new state of the peer, and whether the state changed
+ */
+func (set *AddrSet) MarkMissedReply(address string) (string, bool) {
+	set.lock.Lock()
+	defer set.lock.Unlock()
+	liveness, exist := set.liveness[address]
+	if !exist {
+		return "", false
+	}
+	liveness.MissedReplies++
+	oldState := liveness.State
+	if set.deadAfter > 0 && liveness.MissedReplies >= set.deadAfter {
+		if liveness.State != constants.PEER_DEAD {
+			liveness.DeadSince = set.clock.Now()
+		}
+		liveness.State = constants.PEER_DEAD
+	} else if set.suspectAfter > 0 && liveness.MissedReplies >= set.suspectAfter {
+		liveness.State = constants.PEER_SUSPECT
+	}
+	return liveness.State, liveness.State != oldState
+}
+
+/*
+	IsReachable returns whether the peer with the given address is alive and already sent us a packet
+ */
+func (set *AddrSet) IsReachable(address string) bool {
+	set.lock.RLock()
+	defer set.lock.RUnlock()
+	liveness, exist := set.liveness[address]
+	return exist && liveness.State == constants.PEER_ALIVE && !liveness.LastReceived.IsZero()
+}
+
+/*
+	ChooseRandomDeadPeer returns a dead peer chosen at random, or nil if no peer is dead
+ */
+func (set *AddrSet) ChooseRandomDeadPeer() *net.UDPAddr {
+	set.lock.RLock()
+	defer set.lock.RUnlock()
+	dead := make([]*net.UDPAddr, 0)
+	for _, addr := range set.addresses {
+		if set.liveness[addr.String()].State == constants.PEER_DEAD {
+			dead = append(dead, addr)
+		}
+	}
+	if len(dead) == 0 {
+		return nil
+	}
+	return dead[rand.Intn(len(dead))]
+}
+
+/*
+	RemoveDeadPeers forgets the peers that have been dead for more than maxAge, and returns their addresses
+ */
+func (set *AddrSet) RemoveDeadPeers(maxAge time.Duration) []string {
+	set.lock.Lock()
+	defer set.lock.Unlock()
+	removed := make([]string, 0)
+	addresses := make([]*net.UDPAddr, 0, len(set.addresses))
+	for _, addr := range set.addresses {
+		liveness := set.liveness[addr.String()]
+		if liveness.State == constants.PEER_DEAD && set.clock.Now().Sub(liveness.DeadSince) > maxAge {
+			delete(set.liveness, addr.String())
+			removed = append(removed, addr.String())
+			continue
+		}
+		addresses = append(addresses, addr)
+	}
+	set.addresses = addresses
+	return removed
+}
+
+/*
+	GetLiveness returns a copy of the liveness of every peer, dead ones included, in the order they were added
+ */
+func (set *AddrSet) GetLiveness() []PeerLiveness {
+	set.lock.RLock()
+	defer set.lock.RUnlock()
+	livenessCopy := make([]PeerLiveness, 0, len(set.addresses))
+	for _, addr := range set.addresses {
+		livenessCopy = append(livenessCopy, *set.liveness[addr.String()])
+	}
+	return livenessCopy
+}
+
+/*
+	liveAddresses returns the addresses of the peers that are not dead. The caller must hold the lock
+ */
+func (set *AddrSet) liveAddresses() []*net.UDPAddr {
+	addresses := make([]*net.UDPAddr, 0, len(set.addresses))
+	for _, addr := range set.addresses {
+		if set.liveness[addr.String()].State != constants.PEER_DEAD {
+			addresses = append(addresses, addr)
+		}
+	}
+	return addresses
+}
+
 /*
 	contains checks whether the provided address is already present in our set or not
  */
@@ -51,7 +273,7 @@ func (set *AddrSet) contains(addr string) bool {
 func (set *AddrSet) String() string {
 	str := "\nPEERS "
 	set.lock.RLock()
-	for i, address := range set.addresses {
+	for i, address := range set.liveAddresses() {
 		if i > 0 { str += "," }
 		str += address.String()
 	}
@@ -60,21 +282,19 @@ func (set *AddrSet) String() string {
 }
 
 /*
-	Size returns the size of the set
+	Size returns the number of peers of the set that are not dead
  */
 func (set *AddrSet) Size() int {
 	set.lock.RLock()
 	defer set.lock.RUnlock()
-	return len(set.addresses)
+	return len(set.liveAddresses())
 }
 
 /*
-	returns whether our set is empty or not
+	returns whether our set has no peer that is not dead
  */
 func (set *AddrSet) IsEmpty() bool {
-	set.lock.RLock()
-	defer set.lock.RUnlock()
-	return len(set.addresses) <= 0
+	return set.Size() <= 0
 }
 
 /*
@@ -87,25 +307,26 @@ func (set *AddrSet) ChooseRandomPeerExcept(except string) *net.UDPAddr {
 	var address *net.UDPAddr
 	set.lock.RLock()
 	defer set.lock.RUnlock()
-	if set.Size() <= 1 {
+	addresses := set.liveAddresses()
+	if len(addresses) <= 1 {
 		println("ERROR : requesting a random peer except one but he is the only known peer")
 		return nil
 	}
-	for address = set.addresses[rand.Intn(len(set.addresses))] ;
+	for address = addresses[rand.Intn(len(addresses))] ;
 		strings.EqualFold(address.String(), except) ;
-		address = set.addresses[rand.Intn(len(set.addresses))] {}
+		address = addresses[rand.Intn(len(addresses))] {}
 
 	return address
 }
 
 /*
-	GetAddressesExcept returns the blocks of addresses except the one that is given as parameter
+	GetAddressesExcept returns the addresses of the peers that are not dead, except the one that is given as parameter
  */
 func (set *AddrSet) GetAddressesExcept(except string) []*net.UDPAddr {
 	addressesCopy := make([]*net.UDPAddr, 0)
 	set.lock.RLock()
 	defer set.lock.RUnlock()
-	for _, addr := range set.addresses {
+	for _, addr := range set.liveAddresses() {
 		if !strings.EqualFold(addr.String(), except) {
 			addressesCopy = append(addressesCopy, addr)
 		}
@@ -114,31 +335,28 @@ func (set *AddrSet) GetAddressesExcept(except string) []*net.UDPAddr {
 }
 
 /*
-	GetAddresses returns a copy of the addresses from the set
+	GetAddresses returns a copy of the addresses of the peers that are not dead
  */
 func (set *AddrSet) GetAddresses() []*net.UDPAddr {
-	addressesCopy := make([]*net.UDPAddr, 0)
 	set.lock.RLock()
 	defer set.lock.RUnlock()
-	for _, addr := range set.addresses {
-		addressesCopy = append(addressesCopy, addr)
-	}
-	return addressesCopy
+	return set.liveAddresses()
 }
 
 /*
-	ChooseRandomPeer return a peer chosen at random from the blocks. This method assumes that the user checks
-	that the set is not empty before calling it. However, if the user do call with an empty set, the method
-	will display an error message and return a nil address
+	ChooseRandomPeer return a peer that is not dead chosen at random from the blocks. This method assumes that the
+	user checks that the set is not empty before calling it. However, if the user do call with an empty set, the
+	method will display an error message and return a nil address
  */
 func (set *AddrSet) ChooseRandomPeer() *net.UDPAddr {
 	set.lock.RLock()
 	defer set.lock.RUnlock()
-	if set.Size() == 0 {
+	addresses := set.liveAddresses()
+	if len(addresses) == 0 {
 		println("Cannot return random peer from an empty blocks")
 		return nil
 	}
-	return set.addresses[rand.Intn(len(set.addresses))]
+	return addresses[rand.Intn(len(addresses))]
 }
 
 /*
@@ -155,11 +373,13 @@ func (set *AddrSet) GetAddressesAsStringArray() []string {
 }
 
 /*
-	CreateAddrSet creates an AddrSet from the given string, that may be empty or not
+	CreateAddrSet creates an AddrSet from the given string, that may be empty or not. The liveness of the peers is
+	dated with the clock
  */
-func CreateAddrSet(str string) *AddrSet {
+func CreateAddrSet(str string, clock Clock) *AddrSet {
 	str = strings.Replace(str, " ", "", -1)
-	peers := AddrSet{ addresses: make([]*net.UDPAddr, 0) }
+	peers := AddrSet{ addresses: make([]*net.UDPAddr, 0), liveness: make(map[string]*PeerLiveness),
+		suspectAfter: constants.PEER_SUSPECT_AFTER, deadAfter: constants.PEER_DEAD_AFTER, clock: clock }
 	if strings.EqualFold(str, "") {
 		return &peers
 	} else {
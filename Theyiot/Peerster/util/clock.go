@@ -0,0 +1,235 @@
+package util
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+/*
+	A Clock gives the time to the gossiper and wakes it up when its timers and tickers expire. The RealClock follows
+	the time of the system, while a VirtualClock only moves forward when it is told to, which lets simulations run
+	many seconds of gossip in a few milliseconds
+ */
+type Clock interface {
+	Now() time.Time
+	NewTicker(period time.Duration) *Ticker
+	NewTimer(duration time.Duration) *Timer
+	AfterFunc(duration time.Duration, function func())
+	Sleep(duration time.Duration)
+}
+
+/*
+	A Ticker sends the time on C every period, until it is stopped. As with time.Ticker, ticks are dropped if the
+	reader is too slow
+ */
+type Ticker struct {
+	C		<-chan time.Time
+	stop	func()
+}
+
+/*
+	Stop turns off the ticker, no more ticks are sent
+ */
+func (ticker *Ticker) Stop() {
+	ticker.stop()
+}
+
+/*
+	A Timer sends the time on C once its duration is elapsed, unless it is stopped before
+ */
+type Timer struct {
+	C		<-chan time.Time
+	stop	func()
+}
+
+/*
+	Stop prevents the timer from firing, if it did not fire already
+ */
+func (timer *Timer) Stop() {
+	timer.stop()
+}
+
+/*
+	The RealClock is the Clock of the system
+ */
+type RealClock struct {}
+
+/*
+	Now returns the time of the system
+ */
+func (RealClock) Now() time.Time {
+	return time.Now()
+}
+
+/*
+	NewTicker creates a Ticker following the time of the system
+ */
+func (RealClock) NewTicker(period time.Duration) *Ticker {
+	ticker := time.NewTicker(period)
+	return &Ticker{ C: ticker.C, stop: ticker.Stop }
+}
+
+/*
+	NewTimer creates a Timer following the time of the system
+ */
+func (RealClock) NewTimer(duration time.Duration) *Timer {
+	timer := time.NewTimer(duration)
+	return &Timer{ C: timer.C, stop: func() { timer.Stop() } }
+}
+
+/*
+	AfterFunc calls the function in its own goroutine once the duration is elapsed
+ */
+func (RealClock) AfterFunc(duration time.Duration, function func()) {
+	time.AfterFunc(duration, function)
+}
+
+/*
+	Sleep blocks for the given duration
+ */
+func (RealClock) Sleep(duration time.Duration) {
+	time.Sleep(duration)
+}
+
+/*
+	A VirtualClock is a Clock whose time only moves forward when Advance is called. Timers, tickers and functions
+	are fired in the order of their deadlines
+ */
+type VirtualClock struct {
+	now			time.Time
+	waiters		[]*virtualWaiter
+	lock		sync.Mutex
+}
+
+/*
+	A virtualWaiter is a timer, a ticker (if its period is not zero) or a function waiting for the virtual time to
+	reach its deadline
+ */
+type virtualWaiter struct {
+	deadline	time.Time
+	period		time.Duration
+	channel		chan time.Time
+	function	func()
+}
+
+/*
+	Now returns the virtual time
+ */
+func (clock *VirtualClock) Now() time.Time {
+	clock.lock.Lock()
+	defer clock.lock.Unlock()
+	return clock.now
+}
+
+/*
+	NewTicker creates a Ticker firing every period of virtual time
+ */
+func (clock *VirtualClock) NewTicker(period time.Duration) *Ticker {
+	channel := make(chan time.Time, 1)
+	waiter := clock.add(&virtualWaiter{ period: period, channel: channel }, period)
+	return &Ticker{ C: channel, stop: func() { clock.remove(waiter) } }
+}
+
+/*
+	NewTimer creates a Timer firing after the given duration of virtual time
+ */
+func (clock *VirtualClock) NewTimer(duration time.Duration) *Timer {
+	channel := make(chan time.Time, 1)
+	waiter := clock.add(&virtualWaiter{ channel: channel }, duration)
+	return &Timer{ C: channel, stop: func() { clock.remove(waiter) } }
+}
+
+/*
+	AfterFunc calls the function in its own goroutine once the virtual duration is elapsed
+ */
+func (clock *VirtualClock) AfterFunc(duration time.Duration, function func()) {
+	clock.add(&virtualWaiter{ function: function }, duration)
+}
+
+/*
+	Sleep blocks until the virtual time moved forward by the given duration
+ */
+func (clock *VirtualClock) Sleep(duration time.Duration) {
+	<-clock.NewTimer(duration).C
+}
+
+/*
+	Advance moves the virtual time forward by the given duration, firing on the way every timer, ticker and function
+	whose deadline is reached
+ */
+func (clock *VirtualClock) Advance(duration time.Duration) {
+	clock.lock.Lock()
+	target := clock.now.Add(duration)
+	clock.lock.Unlock()
+	for {
+		clock.lock.Lock()
+		if len(clock.waiters) == 0 || clock.waiters[0].deadline.After(target) {
+			clock.now = target
+			clock.lock.Unlock()
+			return
+		}
+		waiter := clock.waiters[0]
+		clock.waiters = clock.waiters[1:]
+		clock.now = waiter.deadline
+		if waiter.period > 0 {
+			waiter.deadline = waiter.deadline.Add(waiter.period)
+			clock.insert(waiter)
+		}
+		now := clock.now
+		clock.lock.Unlock()
+
+		if waiter.function != nil {
+			go waiter.function()
+		} else {
+			select {
+			case waiter.channel <- now:
+			default:
+			}
+		}
+	}
+}
+
+/*
+	add registers a waiter whose deadline is the given duration from now
+ */
+func (clock *VirtualClock) add(waiter *virtualWaiter, duration time.Duration) *virtualWaiter {
+	clock.lock.Lock()
+	defer clock.lock.Unlock()
+	waiter.deadline = clock.now.Add(duration)
+	clock.insert(waiter)
+	return waiter
+}
+
+/*
+	insert puts a waiter among the others, sorted by deadline. The caller must hold the lock
+ */
+func (clock *VirtualClock) insert(waiter *virtualWaiter) {
+	index := sort.Search(len(clock.waiters), func(i int) bool {
+		return clock.waiters[i].deadline.After(waiter.deadline)
+	})
+	clock.waiters = append(clock.waiters, nil)
+	copy(clock.waiters[index+1:], clock.waiters[index:])
+	clock.waiters[index] = waiter
+}
+
+/*
+	remove forgets a waiter, if it is still waiting
+ */
+func (clock *VirtualClock) remove(waiter *virtualWaiter) {
+	clock.lock.Lock()
+	defer clock.lock.Unlock()
+	for i, other := range clock.waiters {
+		if other == waiter {
+			clock.waiters = append(clock.waiters[:i], clock.waiters[i+1:]...)
+			return
+		}
+	}
+}
+
+/*
+	CreateVirtualClock creates a VirtualClock whose time starts at the given instant
+ */
+func CreateVirtualClock(start time.Time) *VirtualClock {
+	return &VirtualClock{ now: start, waiters: make([]*virtualWaiter, 0) }
+}
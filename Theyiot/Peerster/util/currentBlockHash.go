@@ -17,8 +17,8 @@ func (current *CurrentBlockHash) GetCurrentHash() string {
 	return current.currentHash
 }
 func (current *CurrentBlockHash) SetCurrentHash(newHash string) {
-	current.lock.RLock()
-	defer current.lock.RUnlock()
+	current.lock.Lock()
+	defer current.lock.Unlock()
 	current.currentHash = newHash
 }
 
@@ -29,14 +29,14 @@ func (current *CurrentBlockHash) GetDepth() uint64 {
 }
 
 func (current *CurrentBlockHash) IncrementDepth() {
-	current.lock.RLock()
-	defer current.lock.RUnlock()
+	current.lock.Lock()
+	defer current.lock.Unlock()
 	current.depth++
 }
 
 func (current *CurrentBlockHash) SetDepth(newDepth uint64) {
-	current.lock.RLock()
-	defer current.lock.RUnlock()
+	current.lock.Lock()
+	defer current.lock.Unlock()
 	current.depth = newDepth
 }
 
@@ -0,0 +1,205 @@
+package util
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+/*
+	A KeyValueLog is a small embedded key-value store. The values are grouped in buckets and every update is appended
+	to a log file, one JSON record per line, so that a crash can at most lose the last line. The whole content is
+	kept in memory and the log is compacted each time it is opened
+ */
+type KeyValueLog struct {
+	path		string
+	buckets		map[string]map[string][]byte
+	file		*os.File
+	lock		sync.RWMutex
+}
+
+type keyValueRecord struct {
+	Bucket		string
+	Key			string
+	Value		[]byte
+	Deleted		bool
+}
+
+/*
+	OpenKeyValueLog opens the log stored at the given path, or creates it if it does not exist yet
+ */
+func OpenKeyValueLog(path string) (*KeyValueLog, error) {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, err
+	}
+	kvLog := &KeyValueLog{ path: path, buckets: make(map[string]map[string][]byte) }
+	if err := kvLog.load(); err != nil {
+		return nil, err
+	}
+	if err := kvLog.compact(); err != nil {
+		return nil, err
+	}
+	return kvLog, nil
+}
+
+/*
+	Put associates the value to the key in the given bucket
+ */
+func (kvLog *KeyValueLog) Put(bucket, key string, value []byte) error {
+	kvLog.lock.Lock()
+	defer kvLog.lock.Unlock()
+	if err := kvLog.append(keyValueRecord{ Bucket: bucket, Key: key, Value: value }); err != nil {
+		return err
+	}
+	kvLog.apply(keyValueRecord{ Bucket: bucket, Key: key, Value: value })
+	return nil
+}
+
+/*
+	Delete removes the key from the given bucket
+ */
+func (kvLog *KeyValueLog) Delete(bucket, key string) error {
+	kvLog.lock.Lock()
+	defer kvLog.lock.Unlock()
+	if _, exist := kvLog.buckets[bucket][key]; !exist {
+		return nil
+	}
+	if err := kvLog.append(keyValueRecord{ Bucket: bucket, Key: key, Deleted: true }); err != nil {
+		return err
+	}
+	kvLog.apply(keyValueRecord{ Bucket: bucket, Key: key, Deleted: true })
+	return nil
+}
+
+/*
+	Get returns the value associated to the key in the given bucket, and whether it exists
+ */
+func (kvLog *KeyValueLog) Get(bucket, key string) ([]byte, bool) {
+	kvLog.lock.RLock()
+	defer kvLog.lock.RUnlock()
+	value, exist := kvLog.buckets[bucket][key]
+	return value, exist
+}
+
+/*
+	Range calls f for every key of the given bucket, until f returns false
+ */
+func (kvLog *KeyValueLog) Range(bucket string, f func(key string, value []byte) bool) {
+	kvLog.lock.RLock()
+	entries := make(map[string][]byte, len(kvLog.buckets[bucket]))
+	for key, value := range kvLog.buckets[bucket] {
+		entries[key] = value
+	}
+	kvLog.lock.RUnlock()
+	for key, value := range entries {
+		if !f(key, value) {
+			return
+		}
+	}
+}
+
+/*
+	Close closes the log file
+ */
+func (kvLog *KeyValueLog) Close() error {
+	kvLog.lock.Lock()
+	defer kvLog.lock.Unlock()
+	if kvLog.file == nil {
+		return nil
+	}
+	err := kvLog.file.Close()
+	kvLog.file = nil
+	return err
+}
+
+/*
+	load replays the log file. A line that can not be decoded (typically the last one if the program stopped while
+	writing it) ends the replay
+ */
+func (kvLog *KeyValueLog) load() error {
+	file, err := os.Open(kvLog.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			// AN INCOMPLETE LAST LINE IS IGNORED
+			return nil
+		}
+		var record keyValueRecord
+		if json.Unmarshal(line, &record) != nil {
+			return nil
+		}
+		kvLog.apply(record)
+	}
+}
+
+/*
+	compact rewrites the log file with only the current values, and keeps it open for the following updates
+ */
+func (kvLog *KeyValueLog) compact() error {
+	tmpFile, err := os.Create(kvLog.path + ".tmp")
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(tmpFile)
+	for bucket, entries := range kvLog.buckets {
+		for key, value := range entries {
+			line, err := json.Marshal(keyValueRecord{ Bucket: bucket, Key: key, Value: value })
+			if err != nil {
+				tmpFile.Close()
+				return err
+			}
+			writer.Write(append(line, '\n'))
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	tmpFile.Close()
+	if err := os.Rename(kvLog.path + ".tmp", kvLog.path); err != nil {
+		return err
+	}
+	kvLog.file, err = os.OpenFile(kvLog.path, os.O_APPEND | os.O_WRONLY, 0644)
+	return err
+}
+
+/*
+	append writes a record at the end of the log file. The lock must be held by the caller
+ */
+func (kvLog *KeyValueLog) append(record keyValueRecord) error {
+	if kvLog.file == nil {
+		return os.ErrClosed
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	_, err = kvLog.file.Write(append(line, '\n'))
+	return err
+}
+
+/*
+	apply updates the in-memory content with a record. The lock must be held by the caller
+ */
+func (kvLog *KeyValueLog) apply(record keyValueRecord) {
+	if record.Deleted {
+		delete(kvLog.buckets[record.Bucket], record.Key)
+		return
+	}
+	entries, exist := kvLog.buckets[record.Bucket]
+	if !exist {
+		entries = make(map[string][]byte)
+		kvLog.buckets[record.Bucket] = entries
+	}
+	entries[record.Key] = record.Value
+}
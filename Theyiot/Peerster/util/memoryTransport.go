@@ -0,0 +1,212 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Theyiot/Peerster/constants"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+/*
+	LinkConditions describe how a link of a MemoryNetwork behaves : the probability that a datagram is lost, and how
+	long a datagram takes to be delivered, plus a random jitter of at most Jitter
+ */
+type LinkConditions struct {
+	Loss			float64
+	Delay			time.Duration
+	Jitter			time.Duration
+}
+
+/*
+	A MemoryNetwork connects MemoryTransports within a single process. Datagrams are delivered through channels,
+	with the losses and delays of the link they go through. The random choices come from a seeded source, so that
+	a network with the same seed, conditions and traffic behaves the same way
+ */
+type MemoryNetwork struct {
+	transports		map[string]*MemoryTransport
+	conditions		LinkConditions
+	links			map[string]LinkConditions
+	random			*rand.Rand
+	clock			Clock
+	lock			sync.Mutex
+}
+
+/*
+	A MemoryTransport is a Transport whose datagrams go through a MemoryNetwork instead of the operating system
+ */
+type MemoryTransport struct {
+	network			*MemoryNetwork
+	address			*net.UDPAddr
+	inbox			chan memoryDatagram
+	closed			chan struct{}
+	closeOnce		sync.Once
+}
+
+/*
+	A memoryDatagram is a datagram waiting in the inbox of a MemoryTransport
+ */
+type memoryDatagram struct {
+	data			[]byte
+	from			*net.UDPAddr
+}
+
+/*
+	Listen creates a MemoryTransport receiving the datagrams sent to the given address, of the form ip:port
+ */
+func (network *MemoryNetwork) Listen(address string) (*MemoryTransport, error) {
+	udpAddr, err := net.ResolveUDPAddr(constants.UDP_VERSION, address)
+	if err != nil {
+		return nil, err
+	}
+	network.lock.Lock()
+	defer network.lock.Unlock()
+	if _, exist := network.transports[udpAddr.String()]; exist {
+		return nil, errors.New("the address " + udpAddr.String() + " is already in use")
+	}
+	transport := &MemoryTransport{ network: network, address: udpAddr,
+		inbox: make(chan memoryDatagram, constants.MEMORY_TRANSPORT_INBOX_SIZE), closed: make(chan struct{}) }
+	network.transports[udpAddr.String()] = transport
+	return transport, nil
+}
+
+/*
+	SetConditions sets the conditions of every link that has no conditions of its own
+ */
+func (network *MemoryNetwork) SetConditions(conditions LinkConditions) {
+	network.lock.Lock()
+	defer network.lock.Unlock()
+	network.conditions = conditions
+}
+
+/*
+	SetClock sets the clock that measures the delays of the links, the time of the system by default
+ */
+func (network *MemoryNetwork) SetClock(clock Clock) {
+	network.lock.Lock()
+	defer network.lock.Unlock()
+	network.clock = clock
+}
+
+/*
+	SetLinkConditions sets the conditions of the link going from one address to another. A loss of 1 cuts the link
+ */
+func (network *MemoryNetwork) SetLinkConditions(from, to string, conditions LinkConditions) {
+	network.lock.Lock()
+	defer network.lock.Unlock()
+	network.links[from + "->" + to] = conditions
+}
+
+/*
+	ResetLinkConditions removes the conditions of all the links, which then follow the conditions set for the network
+ */
+func (network *MemoryNetwork) ResetLinkConditions() {
+	network.lock.Lock()
+	defer network.lock.Unlock()
+	network.links = make(map[string]LinkConditions)
+}
+
+/*
+	deliver hands a datagram to its destination, after the delay of the link, unless the datagram is lost. As with
+	UDP, datagrams to unknown addresses or to a full inbox are silently dropped
+ */
+func (network *MemoryNetwork) deliver(data []byte, from, to *net.UDPAddr) {
+	network.lock.Lock()
+	destination, exist := network.transports[to.String()]
+	conditions, hasOwn := network.links[from.String() + "->" + to.String()]
+	if !hasOwn {
+		conditions = network.conditions
+	}
+	lost := conditions.Loss > 0 && network.random.Float64() < conditions.Loss
+	delay := conditions.Delay
+	if conditions.Jitter > 0 {
+		delay += time.Duration(network.random.Int63n(int64(conditions.Jitter) + 1))
+	}
+	clock := network.clock
+	network.lock.Unlock()
+	if !exist || lost {
+		return
+	}
+
+	datagram := memoryDatagram{ data: append([]byte{}, data...), from: from }
+	if delay <= 0 {
+		destination.push(datagram)
+	} else {
+		clock.AfterFunc(delay, func() { destination.push(datagram) })
+	}
+}
+
+/*
+	push puts a datagram in the inbox of the transport, unless it is full or closed
+ */
+func (transport *MemoryTransport) push(datagram memoryDatagram) {
+	select {
+	case <-transport.closed:
+	case transport.inbox <- datagram:
+	default:
+	}
+}
+
+/*
+	Send sends data to the transport listening on the given address, through the network
+ */
+func (transport *MemoryTransport) Send(data []byte, to *net.UDPAddr) error {
+	select {
+	case <-transport.closed:
+		return transport.closedError()
+	default:
+	}
+	transport.network.deliver(data, transport.address, to)
+	return nil
+}
+
+/*
+	Receive waits for a datagram, copies it into buf and returns its size and the address of its sender. As with
+	UDP, a datagram bigger than buf is truncated
+ */
+func (transport *MemoryTransport) Receive(buf []byte) (int, *net.UDPAddr, error) {
+	select {
+	case <-transport.closed:
+		return 0, nil, transport.closedError()
+	case datagram := <-transport.inbox:
+		return copy(buf, datagram.data), datagram.from, nil
+	}
+}
+
+/*
+	closedError returns the error of the operations on a closed transport, which is net.ErrClosed as for UDP
+ */
+func (transport *MemoryTransport) closedError() error {
+	return fmt.Errorf("the transport %s is closed : %w", transport.address.String(), net.ErrClosed)
+}
+
+/*
+	LocalAddr returns the address on which the transport receives datagrams
+ */
+func (transport *MemoryTransport) LocalAddr() *net.UDPAddr {
+	return transport.address
+}
+
+/*
+	Close stops the transport and frees its address, any pending Receive then returns an error
+ */
+func (transport *MemoryTransport) Close() error {
+	transport.closeOnce.Do(func() {
+		close(transport.closed)
+		transport.network.lock.Lock()
+		delete(transport.network.transports, transport.address.String())
+		transport.network.lock.Unlock()
+	})
+	return nil
+}
+
+/*
+	CreateMemoryNetwork creates a MemoryNetwork without any transport, whose links deliver every datagram
+	immediately, and whose random choices are drawn from the given seed
+ */
+func CreateMemoryNetwork(seed int64) *MemoryNetwork {
+	return &MemoryNetwork{ transports: make(map[string]*MemoryTransport), links: make(map[string]LinkConditions),
+		random: rand.New(rand.NewSource(seed)), clock: RealClock{} }
+}
@@ -0,0 +1,60 @@
+package util
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+/*
+	A RateLimiter is a token bucket that lets at most rate packets go through per second, with bursts of at most
+	rate packets. A rate of zero means that the limiter lets everything go through
+ */
+type RateLimiter struct {
+	rate		float64
+	tokens		float64
+	last		time.Time
+	clock		Clock
+	lock		sync.Mutex
+}
+
+/*
+	Wait blocks until a packet is allowed to go through. Each call takes one token, waiting for it when the bucket
+	is empty. It returns an error if done is closed before the packet can go through
+ */
+func (limiter *RateLimiter) Wait(done <-chan struct{}) error {
+	if limiter.rate == 0 {
+		return nil
+	}
+	limiter.lock.Lock()
+	now := limiter.clock.Now()
+	limiter.tokens += now.Sub(limiter.last).Seconds() * limiter.rate
+	if limiter.tokens > limiter.rate {
+		limiter.tokens = limiter.rate
+	}
+	limiter.last = now
+	limiter.tokens--
+	missing := -limiter.tokens
+	limiter.lock.Unlock()
+
+	// THE TOKEN IS ALREADY TAKEN, WE ONLY WAIT FOR THE BUCKET TO REFILL IT
+	if missing <= 0 {
+		return nil
+	}
+	timer := limiter.clock.NewTimer(time.Duration(missing / limiter.rate * float64(time.Second)))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-done:
+		return errors.New("stopped while waiting for the rate limiter")
+	}
+}
+
+/*
+	CreateRateLimiter creates a RateLimiter letting rate packets go through per second of the clock, or everything
+	if rate is 0
+ */
+func CreateRateLimiter(rate uint, clock Clock) *RateLimiter {
+	return &RateLimiter{ rate: float64(rate), tokens: float64(rate), last: clock.Now(), clock: clock }
+}
@@ -0,0 +1,139 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Theyiot/Peerster/constants"
+	"sync"
+	"time"
+)
+
+/*
+	A Reassembler puts back together the packets that were split into fragments because they did not fit in a
+	single datagram. The number of messages being reassembled, in total and per sender, their size and the total
+	size of the fragments kept are bounded, and a message whose fragments did not all arrive within
+	constants.REASSEMBLY_TIMEOUT seconds is forgotten
+ */
+type Reassembler struct {
+	messages		map[string]*partialMessage	//Map[id@sender]partialMessage
+	pending			map[string]int				//Map[sender]number of messages being reassembled
+	buffered		int
+	clock			Clock
+	lock			sync.Mutex
+}
+
+/*
+	A partialMessage holds the fragments of a message received so far
+ */
+type partialMessage struct {
+	sender			string
+	fragments		[][]byte
+	received		uint32
+	size			int
+	started			time.Time
+}
+
+/*
+	Add stores the fragment with the given index, among count fragments, of the message id sent by sender. It returns
+	the whole message once its last fragment is received, and nil otherwise. An error is returned for a fragment
+	that is inconsistent with the previous ones or that exceeds the bounds of the reassembler
+ */
+func (reassembler *Reassembler) Add(sender string, id uint64, index, count uint32, data []byte) ([]byte, error) {
+	if count == 0 || index >= count {
+		return nil, errors.New("fragment " + fmt.Sprint(index) + " of " + fmt.Sprint(count) + " is not valid")
+	} else if uint64(count) * constants.FRAGMENT_SIZE > constants.MAX_REASSEMBLED_SIZE {
+		return nil, errors.New("a message of " + fmt.Sprint(count) + " fragments is too big to be reassembled")
+	} else if len(data) > constants.FRAGMENT_SIZE {
+		return nil, errors.New("fragment of " + fmt.Sprint(len(data)) + " bytes is too big")
+	}
+
+	reassembler.lock.Lock()
+	defer reassembler.lock.Unlock()
+	reassembler.expire()
+	key := fmt.Sprint(id) + "@" + sender
+	message, exist := reassembler.messages[key]
+	if !exist {
+		if len(reassembler.messages) >= constants.MAX_PENDING_REASSEMBLIES {
+			return nil, errors.New("too many messages are being reassembled, dropping a fragment from " + sender)
+		} else if reassembler.pending[sender] >= constants.MAX_PENDING_REASSEMBLIES_PER_SENDER {
+			return nil, errors.New("too many messages of " + sender + " are being reassembled, dropping a fragment")
+		}
+		message = &partialMessage{ sender: sender, fragments: make([][]byte, count), started: reassembler.clock.Now() }
+		reassembler.messages[key] = message
+		reassembler.pending[sender]++
+	} else if uint32(len(message.fragments)) != count {
+		reassembler.forget(key)
+		return nil, errors.New("fragments of message " + key + " do not agree on their number")
+	}
+
+	if message.fragments[index] != nil {
+		return nil, nil
+	}
+	if reassembler.buffered + len(data) > constants.MAX_REASSEMBLY_BUFFER {
+		return nil, errors.New("too many fragments are kept, dropping a fragment from " + sender)
+	}
+	// THE DATA MAY BELONG TO A BUFFER THAT IS REUSED FOR THE NEXT DATAGRAMS
+	message.fragments[index] = append([]byte{}, data...)
+	message.received++
+	message.size += len(data)
+	reassembler.buffered += len(data)
+	if message.received < count {
+		return nil, nil
+	}
+
+	reassembler.forget(key)
+	whole := make([]byte, 0, int(count) * constants.FRAGMENT_SIZE)
+	for _, fragment := range message.fragments {
+		whole = append(whole, fragment...)
+	}
+	return whole, nil
+}
+
+/*
+	expire forgets the messages that are being reassembled for too long. The caller must hold the lock
+ */
+func (reassembler *Reassembler) expire() {
+	for key, message := range reassembler.messages {
+		if reassembler.clock.Now().Sub(message.started) > constants.REASSEMBLY_TIMEOUT * time.Second {
+			reassembler.forget(key)
+			println("ERROR : message " + key + " was not reassembled in time, " +
+				fmt.Sprint(message.received) + " of " + fmt.Sprint(len(message.fragments)) + " fragments received")
+		}
+	}
+}
+
+/*
+	forget removes a message from the ones being reassembled. The caller must hold the lock
+ */
+func (reassembler *Reassembler) forget(key string) {
+	message := reassembler.messages[key]
+	delete(reassembler.messages, key)
+	reassembler.buffered -= message.size
+	reassembler.pending[message.sender]--
+	if reassembler.pending[message.sender] <= 0 {
+		delete(reassembler.pending, message.sender)
+	}
+}
+
+/*
+	SplitIntoFragments splits data into fragments of at most constants.FRAGMENT_SIZE bytes
+ */
+func SplitIntoFragments(data []byte) [][]byte {
+	fragments := make([][]byte, 0, len(data) / constants.FRAGMENT_SIZE + 1)
+	for start := 0 ; start < len(data) ; start += constants.FRAGMENT_SIZE {
+		end := start + constants.FRAGMENT_SIZE
+		if end > len(data) {
+			end = len(data)
+		}
+		fragments = append(fragments, data[start:end])
+	}
+	return fragments
+}
+
+/*
+	CreateReassembler creates a Reassembler that is not reassembling any message yet, and times out the messages
+	with the clock
+ */
+func CreateReassembler(clock Clock) *Reassembler {
+	return &Reassembler{ messages: make(map[string]*partialMessage), pending: make(map[string]int), clock: clock }
+}
@@ -0,0 +1,145 @@
+package util
+
+import (
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+/*
+	A RouteEntry is what we know about the route towards an origin : the next hop, the highest sequence number
+	(the ID of a rumor) we received from the origin through it, the number of hops to the origin, the last time
+	the route was confirmed and the type of packet that taught it to us
+ */
+type RouteEntry struct {
+	Destination		string
+	NextHop			*net.UDPAddr
+	Seq				uint32
+	Hops			uint32
+	Updated			time.Time
+	LearnedFrom		string
+}
+
+/*
+	A RoutingTable is a destination-sequenced distance vector. A route is only replaced by a fresher one, namely
+	one with a higher sequence number, or by a shorter one with the same sequence number
+ */
+type RoutingTable struct {
+	routes		map[string]*RouteEntry
+	clock		Clock
+	lock		sync.RWMutex
+}
+
+/*
+	Update proposes a route towards the destination through the given next hop, and returns true if it replaced
+	the known route. A route with the same next hop and the same sequence number only refreshes the entry
+ */
+func (table *RoutingTable) Update(destination string, nextHop *net.UDPAddr, seq, hops uint32, learnedFrom string) bool {
+	table.lock.Lock()
+	defer table.lock.Unlock()
+	entry, exist := table.routes[destination]
+	switch {
+	case !exist:
+	case seq > entry.Seq, seq == entry.Seq && hops < entry.Hops:
+	case seq == entry.Seq && entry.NextHop.String() == nextHop.String():
+		entry.Updated = table.clock.Now()
+		return false
+	default:
+		return false
+	}
+
+	table.routes[destination] = &RouteEntry{Destination: destination, NextHop: nextHop, Seq: seq, Hops: hops,
+		Updated: table.clock.Now(), LearnedFrom: learnedFrom}
+	return true
+}
+
+/*
+	Restore puts back an entry that was stored by a previous run of the gossiper
+ */
+func (table *RoutingTable) Restore(entry RouteEntry) {
+	if entry.NextHop == nil {
+		return
+	}
+	table.lock.Lock()
+	defer table.lock.Unlock()
+	table.routes[entry.Destination] = &entry
+}
+
+/*
+	GetNextHop returns the address to which the packets for the destination must be sent, and whether we know a
+	route to it
+ */
+func (table *RoutingTable) GetNextHop(destination string) (*net.UDPAddr, bool) {
+	table.lock.RLock()
+	defer table.lock.RUnlock()
+	entry, exist := table.routes[destination]
+	if !exist {
+		return nil, false
+	}
+	return entry.NextHop, true
+}
+
+/*
+	GetEntry returns a copy of the route towards the destination, and whether we know a route to it
+ */
+func (table *RoutingTable) GetEntry(destination string) (RouteEntry, bool) {
+	table.lock.RLock()
+	defer table.lock.RUnlock()
+	entry, exist := table.routes[destination]
+	if !exist {
+		return RouteEntry{}, false
+	}
+	return *entry, true
+}
+
+/*
+	GetEntries returns a copy of all the routes, sorted by destination
+ */
+func (table *RoutingTable) GetEntries() []RouteEntry {
+	table.lock.RLock()
+	entries := make([]RouteEntry, 0, len(table.routes))
+	for _, entry := range table.routes {
+		entries = append(entries, *entry)
+	}
+	table.lock.RUnlock()
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Destination < entries[j].Destination
+	})
+	return entries
+}
+
+/*
+	GetDestinations returns the sorted list of the destinations to which we know a route
+ */
+func (table *RoutingTable) GetDestinations() []string {
+	entries := table.GetEntries()
+	destinations := make([]string, len(entries))
+	for i, entry := range entries {
+		destinations[i] = entry.Destination
+	}
+	return destinations
+}
+
+/*
+	Expire removes the routes that were not confirmed during the given duration, and returns their destinations
+ */
+func (table *RoutingTable) Expire(maxAge time.Duration) []string {
+	table.lock.Lock()
+	defer table.lock.Unlock()
+	expired := make([]string, 0)
+	for destination, entry := range table.routes {
+		if table.clock.Now().Sub(entry.Updated) > maxAge {
+			delete(table.routes, destination)
+			expired = append(expired, destination)
+		}
+	}
+	return expired
+}
+
+/*
+	CreateRoutingTable creates a RoutingTable that does not know any route yet, and dates its routes with the clock
+ */
+func CreateRoutingTable(clock Clock) *RoutingTable {
+	return &RoutingTable{ routes: make(map[string]*RouteEntry), clock: clock }
+}
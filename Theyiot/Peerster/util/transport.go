@@ -0,0 +1,68 @@
+package util
+
+import (
+	"github.com/Theyiot/Peerster/constants"
+	"net"
+)
+
+/*
+	A Transport sends and receives datagrams on behalf of a gossiper. Peers are identified by their address, whether
+	the datagrams actually go through UDP or not
+ */
+type Transport interface {
+	Send(data []byte, to *net.UDPAddr) error
+	Receive(buf []byte) (int, *net.UDPAddr, error)
+	LocalAddr() *net.UDPAddr
+	Close() error
+}
+
+/*
+	An UDPTransport is a Transport sending and receiving real UDP datagrams
+ */
+type UDPTransport struct {
+	conn		*net.UDPConn
+}
+
+/*
+	Send sends data in a single datagram to the given address
+ */
+func (transport *UDPTransport) Send(data []byte, to *net.UDPAddr) error {
+	_, err := transport.conn.WriteToUDP(data, to)
+	return err
+}
+
+/*
+	Receive waits for a datagram, copies it into buf and returns its size and the address of its sender
+ */
+func (transport *UDPTransport) Receive(buf []byte) (int, *net.UDPAddr, error) {
+	return transport.conn.ReadFromUDP(buf)
+}
+
+/*
+	LocalAddr returns the address on which the transport receives datagrams
+ */
+func (transport *UDPTransport) LocalAddr() *net.UDPAddr {
+	return transport.conn.LocalAddr().(*net.UDPAddr)
+}
+
+/*
+	Close stops the transport, any pending Receive then returns an error
+ */
+func (transport *UDPTransport) Close() error {
+	return transport.conn.Close()
+}
+
+/*
+	CreateUDPTransport creates an UDPTransport listening on the given address, of the form ip:port
+ */
+func CreateUDPTransport(address string) (*UDPTransport, error) {
+	udpAddr, err := net.ResolveUDPAddr(constants.UDP_VERSION, address)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP(constants.UDP_VERSION, udpAddr)
+	if err != nil {
+		return nil, err
+	}
+	return &UDPTransport{ conn: conn }, nil
+}
@@ -40,4 +40,42 @@ let requestFile = function(fileName, hashRequest) {
         });
         alert("Your file was correctly downloaded !")
     });
-};
\ No newline at end of file
+};
+
+let requestFileByName = function(fileName) {
+    if(fileName.val() === "") {
+        fileName.select();
+        alert("You need to enter the name, bound on the blockchain, of the file you want to download");
+        return false;
+    }
+    $.ajax({
+        type: "POST",
+        url: "/nameRequesting",
+        contentType: 'application/json; charset=utf-8',
+        data: JSON.stringify({ "Text": fileName.val() }),
+        dataType: 'json',
+    }).done(function(indexedFiles) {
+        let table = document.getElementById("tableFiles");
+        table.innerHTML = `
+                    <colgroup>
+                        <col width="370px">
+                        <col width="150px">
+                    </colgroup>
+                    <tr>
+                        <th>Metahash</th>
+                        <th>File name</th>
+                    </tr>`;
+
+        Object.keys(indexedFiles).forEach(function (metaHash) {
+            let metaHashTable = document.createElement("td");
+            let fileNameTable = document.createElement("td");
+            metaHashTable.appendChild(document.createTextNode(metaHash));
+            fileNameTable.appendChild(document.createTextNode(indexedFiles[metaHash]));
+            let row = document.createElement("tr");
+            row.appendChild(metaHashTable);
+            row.appendChild(fileNameTable);
+            table.appendChild(row);
+        });
+        alert("Your file was correctly downloaded !")
+    });
+};
@@ -11,22 +11,29 @@ let getAddresses = function() {
             `<colgroup>
                 <col width="150">
                 <col width="55">
+                <col width="60">
             </colgroup>
 
             <tr>
                 <th>IP address</th>
                 <th>Port</th>
+                <th>State</th>
             </tr>`;
 
         for(let i = 0 ; i < peers.length ; i++) {
             let addrTable = document.createElement("td");
             let portTable = document.createElement("td");
-            let addrPort = peers[i].split(":");
+            let stateTable = document.createElement("td");
+            let addrPort = peers[i].Address.split(":");
             addrTable.appendChild(document.createTextNode(addrPort[0]));
             portTable.appendChild(document.createTextNode(addrPort[1]));
+            stateTable.appendChild(document.createTextNode(peers[i].State));
+            stateTable.title = peers[i].LastReceived === "" ? "Never heard from" :
+                "Last heard from " + peers[i].LastReceived + ", missed " + peers[i].MissedReplies + " replies";
             let row = document.createElement("tr");
             row.appendChild(addrTable);
             row.appendChild(portTable);
+            row.appendChild(stateTable);
             tabBody.appendChild(row);
         }
     }).always(function() {
@@ -14,7 +14,9 @@ let getPrivateMessages = function() {
         let msgList = privates[privatePeer];
         for(let i = 0 ; i < msgList.length ; i++) {
             let msg = msgList[i].Private;
-            str +=  (msg.Origin === privatePeer ? msg.Origin : "Me") + " :\n" + msg.Text + "\n";
+            let encrypted = msg.EncryptedText ? " (encrypted)" : "";
+            let status = msgList[i].Status ? " [" + msgList[i].Status + "]" : "";
+            str +=  (msg.Origin === privatePeer ? msg.Origin : "Me") + encrypted + status + " :\n" + msg.Text + "\n";
         }
         textPrivate.val(str);
     });
@@ -15,7 +15,8 @@ $("#formSending").submit(function (e) {
     let textMsg = $("#textContent");
     let hashRequest = $("#inputHashRequest");
     let fileName = $("#inputFileName");
-    if(textMsg.val() === "" && !document.getElementById("radioFileRequest").checked) {
+    if(textMsg.val() === "" && !document.getElementById("radioFileRequest").checked &&
+        !document.getElementById("radioNameRequest").checked) {
         textMsg.select();
         alert("You cannot send an empty message, write something before sending");
         return;
@@ -27,6 +28,8 @@ $("#formSending").submit(function (e) {
         success = sendPrivateMessage(textMsg)
     } else if(document.getElementById("radioFileRequest").checked) {
         success = requestFile(fileName, hashRequest);
+    } else if(document.getElementById("radioNameRequest").checked) {
+        success = requestFileByName(fileName);
     }
     if(success) {
         textMsg.val("");